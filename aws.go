@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adammck/venv"
+	"github.com/blang/vfs"
+)
+
+// emptyPayloadHash is the SHA-256 hash of an empty request body.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// awsCredentials are the credentials to sign AWS requests with. Without an
+// access key, requests are sent unsigned.
+type awsCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// awsConfig looks up AWS settings the way the AWS CLI and SDKs do: from the
+// environment, then from the shared credentials and config files.
+type awsConfig struct {
+	fs      vfs.Filesystem
+	env     venv.Env
+	profile string
+}
+
+func newAWSConfig(fs vfs.Filesystem, env venv.Env, profile string) *awsConfig {
+	if profile == "" {
+		profile = env.Getenv("AWS_PROFILE")
+	}
+	if profile == "" {
+		profile = "default"
+	}
+
+	return &awsConfig{fs: fs, env: env, profile: profile}
+}
+
+// credentials returns the credentials from AWS_ACCESS_KEY_ID and friends, or
+// else from the profile in the shared credentials file.
+func (c *awsConfig) credentials() awsCredentials {
+	if id := c.env.Getenv("AWS_ACCESS_KEY_ID"); id != "" {
+		return awsCredentials{
+			AccessKeyID:     id,
+			SecretAccessKey: c.env.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    c.env.Getenv("AWS_SESSION_TOKEN"),
+		}
+	}
+
+	fn := c.env.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if fn == "" {
+		fn = filepath.Join(c.env.Getenv("HOME"), ".aws", "credentials")
+	}
+	section := readINISection(c.fs, fn, c.profile)
+
+	return awsCredentials{
+		AccessKeyID:     section["aws_access_key_id"],
+		SecretAccessKey: section["aws_secret_access_key"],
+		SessionToken:    section["aws_session_token"],
+	}
+}
+
+// region returns the region from AWS_REGION, AWS_DEFAULT_REGION or the profile
+// in the shared config file, or an empty string.
+func (c *awsConfig) region() string {
+	for _, key := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if region := c.env.Getenv(key); region != "" {
+			return region
+		}
+	}
+
+	fn := c.env.Getenv("AWS_CONFIG_FILE")
+	if fn == "" {
+		fn = filepath.Join(c.env.Getenv("HOME"), ".aws", "config")
+	}
+	section := "profile " + c.profile
+	if c.profile == "default" {
+		section = "default"
+	}
+
+	return readINISection(c.fs, fn, section)["region"]
+}
+
+// readINISection returns the keys of the given section of an INI file like
+// `~/.aws/credentials`. A missing file or section has no keys.
+func readINISection(fs vfs.Filesystem, filename string, section string) map[string]string {
+	values := make(map[string]string)
+
+	b, err := vfs.ReadFile(fs, filename)
+	if err != nil {
+		return values
+	}
+
+	current := ""
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			current = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+
+		if i := strings.Index(line, "="); i > 0 && current == section {
+			values[strings.TrimSpace(line[:i])] = strings.TrimSpace(line[i+1:])
+		}
+	}
+
+	return values
+}
+
+// signAWSRequest signs a request without a body with AWS Signature Version 4,
+// see https://docs.aws.amazon.com/IAM/latest/UserGuide/reference_aws-signing.html.
+// All headers of the request are signed.
+func signAWSRequest(req *http.Request, creds awsCredentials, region string, service string, now time.Time) {
+	if creds.AccessKeyID == "" {
+		return
+	}
+
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := []string{}
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		awsURIEncode(req.URL.Path, false),
+		awsCanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptyPayloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// awsCanonicalQuery returns the query parameters sorted and encoded as AWS
+// expects them in canonical requests.
+func awsCanonicalQuery(query map[string][]string) string {
+	var params []string
+	for k, values := range query {
+		for _, v := range values {
+			params = append(params, awsURIEncode(k, true)+"="+awsURIEncode(v, true))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+// awsURIEncode percent-encodes everything but unreserved characters (and
+// slashes, unless encodeSlash is set), as AWS expects it in signed requests.
+func awsURIEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
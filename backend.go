@@ -0,0 +1,69 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/adammck/venv"
+	"github.com/blang/vfs"
+)
+
+// backend is a source of Terraform states with workspaces, e.g. a Terraform
+// project directory or a remote backend like S3.
+type backend interface {
+
+	// state returns the state of the given workspace. An empty workspace is the
+	// default (or currently selected) one.
+	state(workspace string) (io.Reader, error)
+
+	// workspaces returns the names of all workspaces.
+	workspaces() ([]string, error)
+}
+
+// backendTypes are the remote backends, which are given as URLs, by scheme.
+var backendTypes = map[string]func(u *url.URL, fs vfs.Filesystem, env venv.Env) (backend, error){
+	"s3":     newS3Backend,
+	"http":   newHTTPBackend,
+	"https":  newHTTPBackend,
+	"consul": newConsulBackend,
+}
+
+// httpClient is the client for all requests to remote backends.
+var httpClient = &http.Client{Timeout: 60 * time.Second}
+
+// parseBackendURL returns the URL of the remote backend of the given input
+// source, or nil if it's a path.
+func parseBackendURL(source string) *url.URL {
+	u, err := url.Parse(source)
+	if err != nil {
+		return nil
+	}
+
+	if _, exists := backendTypes[u.Scheme]; !exists {
+		return nil
+	}
+
+	return u
+}
+
+// backendSource returns the URL of a remote backend to show in messages,
+// without credentials or parameters.
+func backendSource(u *url.URL) string {
+	return u.Scheme + "://" + u.Host + u.Path
+}
+
+// projectBackend reads the states of a Terraform project directory.
+type projectBackend struct {
+	tf  *Terraform
+	dir string
+}
+
+func (b *projectBackend) state(workspace string) (io.Reader, error) {
+	return b.tf.state(b.dir, workspace)
+}
+
+func (b *projectBackend) workspaces() ([]string, error) {
+	return b.tf.workspaces(b.dir)
+}
@@ -1,12 +1,15 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
-	"os"
+	"reflect"
 	"sort"
 	"strings"
+
+	"gopkg.in/yaml.v2"
 )
 
 type counterSorter struct {
@@ -30,6 +33,24 @@ type allGroup struct {
 	Vars  map[string]interface{} `json:"vars"`
 }
 
+// metaGroup is the special `_meta` group of the `--list` output. If it's
+// present, Ansible takes the host vars from it instead of calling `--host` once
+// for every host.
+type metaGroup struct {
+	Hostvars map[string]map[string]interface{} `json:"hostvars"`
+}
+
+// parentGroup is a group which has other groups as its children, and possibly
+// hosts of its own.
+type parentGroup struct {
+	Hosts    []string `json:"hosts,omitempty"`
+	Children []string `json:"children"`
+}
+
+func (g *parentGroup) String() string {
+	return fmt.Sprintf("%v (children: %v)", g.Hosts, g.Children)
+}
+
 func appendUniq(strs []string, item string) []string {
 	if len(strs) == 0 {
 		strs = append(strs, item)
@@ -43,49 +64,53 @@ func appendUniq(strs []string, item string) []string {
 	return strs
 }
 
-func gatherResources(s *stateAnyTerraformVersion) map[string]interface{} {
-	if s.TerraformVersion == TerraformVersionPre0dot12 {
-		return gatherResourcesPre0dot12(&s.StatePre0dot12)
-	} else if s.TerraformVersion == TerraformVersion0dot12 {
-		return gatherResources0dot12(&s.State0dot12)
-	} else {
-		panic("Unimplemented Terraform version enum")
-	}
-}
-
-func gatherResourcesPre0dot12(s *state) map[string]interface{} {
+// gatherGroups returns the groups of a single state, with the families they
+// belong to.
+func gatherGroups(s *stateAnyTerraformVersion, conf *Config, stderr io.Writer) (*groupNamer, error) {
 	outputGroups := make(map[string]interface{})
 
 	all := &allGroup{Hosts: make([]string, 0), Vars: make(map[string]interface{})}
+	meta := &metaGroup{Hostvars: make(map[string]map[string]interface{})}
 	types := make(map[string][]string)
-	individual := make(map[string][]string)
 	ordered := make(map[string][]string)
 	tags := make(map[string][]string)
+	modules := make(map[string][]string)
+	placement := make(map[string][]string)
+	custom := make(map[string][]string)
+	tagKeys := make(map[string]string)
+	placementKeys := make(map[string]string)
+	orderedChildren := make(map[string][]string)
 
 	unsortedOrdered := make(map[string][]*Resource)
 
+	outputGroups["all"] = all
+	outputGroups["_meta"] = meta
+
+	// groups added first keep their names on collisions
+	namer := newGroupNamer(conf, outputGroups, stderr)
+
 	resourceIDNames := s.mapResourceIDNames()
 	for _, res := range s.resources() {
 		// place in list of all resources
 		all.Hosts = appendUniq(all.Hosts, res.Hostname())
 
+		// store host vars, the first resource wins like in `--host`
+		if _, exists := meta.Hostvars[res.Hostname()]; !exists {
+			meta.Hostvars[res.Hostname()] = hostVars(res, conf)
+		}
+
 		// place in list of resource types
 		tp := fmt.Sprintf("type_%s", res.resourceType)
 		types[tp] = appendUniq(types[tp], res.Hostname())
+		sort.Strings(types[tp])
 
 		unsortedOrdered[res.baseName] = append(unsortedOrdered[res.baseName], res)
 
 		// store as individual host (e.g. <name>_<count>)
-		var invdName string
-		if res.counterStr != "" {
-			invdName = fmt.Sprintf("%s_%s", res.baseName, strings.Replace(res.counterStr, ".", "_", -1))
-		} else {
-			invdName = fmt.Sprintf("%s_%d", res.baseName, res.counterNumeric)
-		}
-		if old, exists := individual[invdName]; exists {
-			fmt.Fprintf(os.Stderr, "overwriting already existing individual key %s, old: %v, new: %v\n", invdName, old, res.Hostname())
+		err := namer.add("individual", map[string][]string{res.individualName(): {res.Hostname()}})
+		if err != nil {
+			return nil, err
 		}
-		individual[invdName] = []string{res.Hostname()}
 
 		// inventorize tags
 		for k, v := range res.Tags() {
@@ -93,15 +118,38 @@ func gatherResourcesPre0dot12(s *state) map[string]interface{} {
 			tag := k
 			if v != "" {
 				tag = fmt.Sprintf("%s_%s", k, v)
+				tagKeys[tag] = k
 			}
 			// if v is a resource ID, then tag should be resource name
 			if _, exists := resourceIDNames[v]; exists {
 				tag = resourceIDNames[v]
 			}
 			tags[tag] = appendUniq(tags[tag], res.Hostname())
+			sort.Strings(tags[tag])
+		}
+
+		// place in groups of the modules it's in (e.g. module_<name>)
+		for _, name := range res.moduleGroups() {
+			modules[name] = appendUniq(modules[name], res.Hostname())
+			sort.Strings(modules[name])
+		}
+
+		// place in groups of its placement (e.g. availability_zone_<zone>)
+		for name, key := range conf.placementGroups(res) {
+			placement[name] = appendUniq(placement[name], res.Hostname())
+			sort.Strings(placement[name])
+			placementKeys[name] = key
+		}
+
+		// place in groups defined in the config file
+		for _, name := range conf.groupsFor(res) {
+			custom[name] = appendUniq(custom[name], res.Hostname())
+			sort.Strings(custom[name])
 		}
 	}
 
+	sort.Strings(all.Hosts)
+
 	// inventorize outputs as variables
 	if len(s.outputs()) > 0 {
 		for _, out := range s.outputs() {
@@ -116,143 +164,271 @@ func gatherResourcesPre0dot12(s *state) map[string]interface{} {
 
 		for i := range resources {
 			ordered[basename] = append(ordered[basename], resources[i].Hostname())
+			if name := resources[i].individualName(); !contains(orderedChildren[basename], name) {
+				orderedChildren[basename] = append(orderedChildren[basename], name)
+			}
 		}
 	}
 
-	outputGroups["all"] = all
-	for k, v := range individual {
-		if old, exists := outputGroups[k]; exists {
-			fmt.Fprintf(os.Stderr, "individual overwriting already existing output with key %s, old: %v, new: %v", k, old, v)
-		}
-		outputGroups[k] = v
+	families := []struct {
+		name   string
+		groups map[string][]string
+	}{
+		{"ordered", ordered},
+		{"types", types},
+		{"tags", tags},
+		{"modules", modules},
+		{"placement", placement},
+		{"custom", custom},
 	}
-	for k, v := range ordered {
-		if old, exists := outputGroups[k]; exists {
-			fmt.Fprintf(os.Stderr, "ordered overwriting already existing output with key %s, old: %v, new: %v", k, old, v)
+	for _, family := range families {
+		err := namer.add(family.name, family.groups)
+		if err != nil {
+			return nil, err
 		}
-		outputGroups[k] = v
 	}
-	for k, v := range types {
-		if old, exists := outputGroups[k]; exists {
-			fmt.Fprintf(os.Stderr, "types overwriting already existing output key %s, old: %v, new: %v", k, old, v)
+	if conf.groupEnabled("hierarchy") {
+		err := addGroupHierarchy(namer, tagKeys, placementKeys, orderedChildren)
+		if err != nil {
+			return nil, err
 		}
-		outputGroups[k] = v
 	}
-	for k, v := range tags {
-		if old, exists := outputGroups[k]; exists {
-			fmt.Fprintf(os.Stderr, "tags overwriting already existing output key %s, old: %v, new: %v", k, old, v)
+
+	// place all hosts of a named state in a group of the same name
+	if s.Name != "" {
+		hosts := append([]string{}, all.Hosts...)
+		err := namer.add("state", map[string][]string{s.Name: hosts})
+		if err != nil {
+			return nil, err
 		}
-		outputGroups[k] = v
 	}
 
-	return outputGroups
+	namer.reportInvalid()
+	return namer, nil
 }
 
-func gatherResources0dot12(s *stateTerraform0dot12) map[string]interface{} {
-	outputGroups := make(map[string]interface{})
+// addGroupHierarchy adds parents to the built-in groups: `terraform_types` for
+// the type groups, the tag keys for the tag groups with values (e.g. `role` for
+// `role_web`), the attributes for the placement groups (e.g. `instance_type`
+// for `instance_type_t3.large`), and the ordered groups for their individual
+// groups.
+func addGroupHierarchy(namer *groupNamer, tagKeys map[string]string, placementKeys map[string]string, orderedChildren map[string][]string) error {
+	if children := namer.names["types"]; len(children) > 0 {
+		names := []string{}
+		for _, name := range children {
+			names = appendUniq(names, name)
+		}
+		sort.Strings(names)
+		err := namer.addParent("types", "terraform_types", names)
+		if err != nil {
+			return err
+		}
+	}
 
-	all := &allGroup{Hosts: make([]string, 0), Vars: make(map[string]interface{})}
-	types := make(map[string][]string)
-	individual := make(map[string][]string)
-	ordered := make(map[string][]string)
-	tags := make(map[string][]string)
+	err := addKeyParents(namer, "tags", tagKeys)
+	if err != nil {
+		return err
+	}
+	err = addKeyParents(namer, "placement", placementKeys)
+	if err != nil {
+		return err
+	}
 
-	unsortedOrdered := make(map[string][]*Resource)
+	for basename, individuals := range orderedChildren {
+		parent, exists := namer.name("ordered", basename)
+		if !exists {
+			continue
+		}
+		children := []string{}
+		for _, individual := range individuals {
+			if name, exists := namer.name("individual", individual); exists && !contains(children, name) {
+				children = append(children, name)
+			}
+		}
+		if len(children) > 0 {
+			addChildren(namer.output, parent, children, namer.stderr)
+		}
+	}
 
-	resourceIDNames := s.mapResourceIDNames()
-	for _, res := range s.resources() {
-		// place in list of all resources
-		all.Hosts = appendUniq(all.Hosts, res.Hostname())
+	return nil
+}
 
-		// place in list of resource types
-		tp := fmt.Sprintf("type_%s", res.resourceType)
-		types[tp] = appendUniq(types[tp], res.Hostname())
-		sort.Strings(types[tp])
+// addKeyParents adds the groups of the given family of the form `<key>_<value>`
+// as children to groups named after their keys.
+func addKeyParents(namer *groupNamer, family string, keys map[string]string) error {
+	children := make(map[string][]string)
+	for name, key := range keys {
+		if child, exists := namer.name(family, name); exists {
+			children[key] = appendUniq(children[key], child)
+		}
+	}
 
-		unsortedOrdered[res.baseName] = append(unsortedOrdered[res.baseName], res)
+	parents := []string{}
+	for key := range children {
+		parents = append(parents, key)
+	}
+	sort.Strings(parents)
 
-		// store as individual host (e.g. <name>_<count>)
-		var invdName string
-		if res.counterStr != "" {
-			invdName = fmt.Sprintf("%s_%s", res.baseName, strings.Replace(res.counterStr, ".", "_", -1))
-		} else {
-			invdName = fmt.Sprintf("%s_%d", res.baseName, res.counterNumeric)
+	for _, key := range parents {
+		sort.Strings(children[key])
+		err := namer.addParent(family, key, children[key])
+		if err != nil {
+			return err
 		}
-		if old, exists := individual[invdName]; exists {
-			fmt.Fprintf(os.Stderr, "overwriting already existing individual key %s, old: %v, new: %v", invdName, old, res.Hostname())
-		}
-		individual[invdName] = []string{res.Hostname()}
+	}
 
-		// inventorize tags
-		for k, v := range res.Tags() {
-			// Valueless
-			tag := k
-			if v != "" {
-				tag = fmt.Sprintf("%s_%s", k, v)
-			}
-			// if v is a resource ID, then tag should be resource name
-			if _, exists := resourceIDNames[v]; exists {
-				tag = resourceIDNames[v]
-			}
-			tags[tag] = appendUniq(tags[tag], res.Hostname())
-			sort.Strings(tags[tag])
+	return nil
+}
+
+// addChildren adds children to the given group. Groups which don't exist yet
+// are created without hosts, and plain groups keep their hosts.
+func addChildren(outputGroups map[string]interface{}, name string, children []string, stderr io.Writer) {
+	switch grp := outputGroups[name].(type) {
+	case nil:
+		outputGroups[name] = &parentGroup{Children: children}
+
+	case []string:
+		outputGroups[name] = &parentGroup{Hosts: grp, Children: children}
+
+	case *parentGroup:
+		for _, child := range children {
+			grp.Children = appendUniq(grp.Children, child)
 		}
+		sort.Strings(grp.Children)
+
+	default:
+		fmt.Fprintf(stderr, "not adding children %v to reserved output key %s\n", children, name)
 	}
+}
 
-	sort.Strings(all.Hosts)
+// gatherInventory gathers the resources of all states and merges them into a
+// single inventory. Groups of the same name and family are merged, other
+// collisions are handled by the collision policy. Hosts and variables which are
+// defined differently by several states are reported to stderr, and the first
+// definition wins.
+func gatherInventory(states []*stateAnyTerraformVersion, conf *Config, stderr io.Writer) (map[string]interface{}, error) {
+	var inventory *groupNamer
+
+	for _, s := range states {
+		groups, err := gatherGroups(s, conf, stderr)
+		if err != nil {
+			return nil, fmt.Errorf("state %s: %s", s.Source, err)
+		}
 
-	// inventorize outputs as variables
-	if len(s.outputs()) > 0 {
-		for _, out := range s.outputs() {
-			all.Vars[out.keyName] = out.value
+		if inventory == nil {
+			inventory = groups
+			continue
+		}
+
+		err = inventory.merge(groups, s.Source)
+		if err != nil {
+			return nil, fmt.Errorf("state %s: %s", s.Source, err)
 		}
 	}
 
-	// sort the ordered groups
-	for basename, resources := range unsortedOrdered {
-		cs := counterSorter{resources}
-		sort.Sort(cs)
+	if inventory == nil {
+		return nil, nil
+	}
+	return inventory.output, nil
+}
 
-		for i := range resources {
-			ordered[basename] = append(ordered[basename], resources[i].Hostname())
+// mergeGroup merges a single group gathered from a state into the group of the
+// same name of the inventory.
+func mergeGroup(inventory map[string]interface{}, k string, group interface{}, source string, stderr io.Writer) {
+	switch grp := group.(type) {
+	case []string:
+		if parent, isParent := inventory[k].(*parentGroup); isParent {
+			for _, host := range grp {
+				parent.Hosts = appendUniq(parent.Hosts, host)
+			}
+			sort.Strings(parent.Hosts)
+			return
 		}
-	}
+		old, isList := inventory[k].([]string)
+		if _, exists := inventory[k]; exists && !isList {
+			fmt.Fprintf(stderr, "state %s defines group %s, ignoring it as the key is reserved\n", source, k)
+			return
+		}
+		for _, host := range grp {
+			old = appendUniq(old, host)
+		}
+		sort.Strings(old)
+		inventory[k] = old
+
+	case *parentGroup:
+		old, isParent := inventory[k].(*parentGroup)
+		if !isParent {
+			list, isList := inventory[k].([]string)
+			if _, exists := inventory[k]; exists && !isList {
+				fmt.Fprintf(stderr, "state %s defines group %s, ignoring it as the key is reserved\n", source, k)
+				return
+			}
+			old = &parentGroup{Hosts: list}
+			inventory[k] = old
+		}
+		for _, host := range grp.Hosts {
+			old.Hosts = appendUniq(old.Hosts, host)
+		}
+		sort.Strings(old.Hosts)
+		for _, child := range grp.Children {
+			old.Children = appendUniq(old.Children, child)
+		}
+		sort.Strings(old.Children)
 
-	outputGroups["all"] = all
-	for k, v := range individual {
-		if old, exists := outputGroups[k]; exists {
-			fmt.Fprintf(os.Stderr, "individual overwriting already existing output with key %s, old: %v, new: %v", k, old, v)
+	case *allGroup:
+		all := inventory[k].(*allGroup)
+		for _, host := range grp.Hosts {
+			all.Hosts = appendUniq(all.Hosts, host)
 		}
-		outputGroups[k] = v
-	}
-	for k, v := range ordered {
-		if old, exists := outputGroups[k]; exists {
-			fmt.Fprintf(os.Stderr, "ordered overwriting already existing output with key %s, old: %v, new: %v", k, old, v)
+		sort.Strings(all.Hosts)
+		for name, value := range grp.Vars {
+			if old, exists := all.Vars[name]; exists {
+				if !reflect.DeepEqual(old, value) {
+					fmt.Fprintf(stderr, "state %s defines variable %s differently, ignoring it, old: %v, new: %v\n", source, name, old, value)
+				}
+				continue
+			}
+			all.Vars[name] = value
 		}
-		outputGroups[k] = v
-	}
-	for k, v := range types {
-		if old, exists := outputGroups[k]; exists {
-			fmt.Fprintf(os.Stderr, "types overwriting already existing output key %s, old: %v, new: %v", k, old, v)
+
+	case *metaGroup:
+		meta := inventory[k].(*metaGroup)
+		for host, vars := range grp.Hostvars {
+			if old, exists := meta.Hostvars[host]; exists {
+				if !reflect.DeepEqual(old, vars) {
+					fmt.Fprintf(stderr, "state %s defines host %s differently, ignoring its host vars\n", source, host)
+				}
+				continue
+			}
+			meta.Hostvars[host] = vars
 		}
-		outputGroups[k] = v
 	}
-	for k, v := range tags {
-		if old, exists := outputGroups[k]; exists {
-			fmt.Fprintf(os.Stderr, "tags overwriting already existing output key %s, old: %v, new: %v", k, old, v)
-		}
-		outputGroups[k] = v
+}
+
+func cmdList(stdout io.Writer, stderr io.Writer, states []*stateAnyTerraformVersion, conf *Config) int {
+	groups, err := gatherInventory(states, conf, stderr)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error gathering inventory: %s\n", err)
+		return 1
 	}
 
-	return outputGroups
+	return output(stdout, stderr, groups)
 }
 
-func cmdList(stdout io.Writer, stderr io.Writer, s *stateAnyTerraformVersion) int {
-	return output(stdout, stderr, gatherResources(s))
+func cmdInventory(stdout io.Writer, stderr io.Writer, states []*stateAnyTerraformVersion, conf *Config) int {
+	groups, err := gatherInventory(states, conf, stderr)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error gathering inventory: %s\n", err)
+		return 1
+	}
+
+	return writeINIInventory(stdout, stderr, groups, conf.INI)
 }
 
-func cmdInventory(stdout io.Writer, stderr io.Writer, s *stateAnyTerraformVersion) int {
-	groups := gatherResources(s)
+// writeINIInventory writes the groups as an INI inventory, with the selected
+// host vars on the host lines of the `all` group.
+func writeINIInventory(stdout io.Writer, stderr io.Writer, groups map[string]interface{}, ini INI) int {
+	meta, _ := groups["_meta"].(*metaGroup)
 	group_names := []string{}
 	for group, _ := range groups {
 		group_names = append(group_names, group)
@@ -267,12 +443,31 @@ func cmdInventory(stdout io.Writer, stderr io.Writer, s *stateAnyTerraformVersio
 				writeLn(item, stdout, stderr)
 			}
 
-		case *allGroup:
+		case *parentGroup:
 			writeLn("["+group+"]", stdout, stderr)
 			for _, item := range grp.Hosts {
 				writeLn(item, stdout, stderr)
 			}
 			writeLn("", stdout, stderr)
+			writeLn("["+group+":children]", stdout, stderr)
+			for _, child := range grp.Children {
+				writeLn(child, stdout, stderr)
+			}
+
+		case *metaGroup:
+			// host vars are written to the host lines of the `all` group
+			continue
+
+		case *allGroup:
+			writeLn("["+group+"]", stdout, stderr)
+			for _, item := range grp.Hosts {
+				line := item
+				if meta != nil {
+					line += iniHostVars(meta.Hostvars[item], ini.hostVars())
+				}
+				writeLn(line, stdout, stderr)
+			}
+			writeLn("", stdout, stderr)
 			writeLn("["+group+":vars]", stdout, stderr)
 			vars := []string{}
 			for key, _ := range grp.Vars {
@@ -280,9 +475,7 @@ func cmdInventory(stdout io.Writer, stderr io.Writer, s *stateAnyTerraformVersio
 			}
 			sort.Strings(vars)
 			for _, key := range vars {
-				jsonItem, _ := json.Marshal(grp.Vars[key])
-				itemLn := fmt.Sprintf("%s", string(jsonItem))
-				writeLn(key+"="+itemLn, stdout, stderr)
+				writeLn(key+"="+pythonLiteral(grp.Vars[key]), stdout, stderr)
 			}
 		}
 
@@ -292,6 +485,157 @@ func cmdInventory(stdout io.Writer, stderr io.Writer, s *stateAnyTerraformVersio
 	return 0
 }
 
+// iniHostVars returns the host vars matching one of the given patterns as
+// `key=value` pairs to append to a host line. Ansible splits host lines like a
+// shell does and evaluates the values as Python literals, so the values are
+// written as Python literals and quoted. Vars whose names aren't valid Ansible
+// variable names (e.g. `tags.#`) and values which couldn't be read from the
+// state are left out.
+func iniHostVars(vars map[string]interface{}, patterns []string) string {
+	keys := []string{}
+	for key, value := range vars {
+		if value == "<error>" || !validVarName(key) || !matchAny(patterns, key) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, key := range keys {
+		b.WriteString(" " + shellQuote(key) + "=" + shellQuote(pythonLiteral(vars[key])))
+	}
+	return b.String()
+}
+
+// validVarName returns whether the given name is a valid Ansible variable name,
+// i.e. consists of letters, digits and underscores, and doesn't start with a
+// digit.
+func validVarName(name string) bool {
+	return name != "" && (GroupNames{Sanitize: true}).sanitize(name) == name
+}
+
+// shellQuote quotes a string in single quotes, unless it consists of characters
+// which a shell wouldn't interpret only.
+func shellQuote(s string) string {
+	safe := s != ""
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("_-.,:/@+", c)) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'"'"'`, -1) + "'"
+}
+
+// pythonLiteral returns the value as a Python literal, which Ansible evaluates
+// to the same value as the JSON inventory would contain.
+func pythonLiteral(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "None"
+	case bool:
+		if v {
+			return "True"
+		}
+		return "False"
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = pythonLiteral(item)
+		}
+		return "[" + strings.Join(items, ",") + "]"
+	case map[string]interface{}:
+		keys := []string{}
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		items := make([]string, len(keys))
+		for i, key := range keys {
+			items[i] = pythonLiteral(key) + ":" + pythonLiteral(v[key])
+		}
+		return "{" + strings.Join(items, ",") + "}"
+	default:
+		// strings and numbers are written the same in JSON and Python
+		var b bytes.Buffer
+		enc := json.NewEncoder(&b)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(v); err != nil {
+			return pythonLiteral(fmt.Sprint(v))
+		}
+		return strings.TrimSuffix(b.String(), "\n")
+	}
+}
+
+// yamlInventory converts the groups into the structure of Ansible's YAML
+// inventory: all hosts with their vars below `all`, and the other groups as its
+// children.
+func yamlInventory(groups map[string]interface{}) map[string]interface{} {
+	all := groups["all"].(*allGroup)
+	meta := groups["_meta"].(*metaGroup)
+
+	hosts := make(map[string]interface{})
+	for _, host := range all.Hosts {
+		hosts[host] = meta.Hostvars[host]
+	}
+
+	children := make(map[string]interface{})
+	for name, grp := range groups {
+		switch grp := grp.(type) {
+		case []string:
+			children[name] = map[string]interface{}{"hosts": yamlKeys(grp)}
+
+		case *parentGroup:
+			child := map[string]interface{}{"children": yamlKeys(grp.Children)}
+			if len(grp.Hosts) > 0 {
+				child["hosts"] = yamlKeys(grp.Hosts)
+			}
+			children[name] = child
+		}
+	}
+
+	out := map[string]interface{}{"hosts": hosts}
+	if len(all.Vars) > 0 {
+		out["vars"] = all.Vars
+	}
+	if len(children) > 0 {
+		out["children"] = children
+	}
+
+	return map[string]interface{}{"all": out}
+}
+
+// yamlKeys returns a map with the given keys and empty values, which is how
+// the YAML inventory lists hosts and groups.
+func yamlKeys(keys []string) map[string]interface{} {
+	m := make(map[string]interface{})
+	for _, key := range keys {
+		m[key] = nil
+	}
+	return m
+}
+
+func cmdYAML(stdout io.Writer, stderr io.Writer, states []*stateAnyTerraformVersion, conf *Config) int {
+	groups, err := gatherInventory(states, conf, stderr)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error gathering inventory: %s\n", err)
+		return 1
+	}
+
+	b, err := yaml.Marshal(yamlInventory(groups))
+	if err != nil {
+		fmt.Fprintf(stderr, "Error encoding YAML: %s\n", err)
+		return 1
+	}
+
+	_, err = stdout.Write(b)
+	return checkErr(err, stderr)
+}
+
 func writeLn(str string, stdout io.Writer, stderr io.Writer) {
 	_, err := io.WriteString(stdout, str+"\n")
 	checkErr(err, stderr)
@@ -305,12 +649,12 @@ func checkErr(err error, stderr io.Writer) int {
 	return 0
 }
 
-func cmdHost(stdout io.Writer, stderr io.Writer, s *stateAnyTerraformVersion, hostname string) int {
-	for _, res := range s.resources() {
-		if hostname == res.Hostname() {
-			attributes := res.Attributes()
-			attributes["ansible_host"] = res.Address()
-			return output(stdout, stderr, attributes)
+func cmdHost(stdout io.Writer, stderr io.Writer, states []*stateAnyTerraformVersion, hostname string, conf *Config) int {
+	for _, s := range states {
+		for _, res := range s.resources() {
+			if hostname == res.Hostname() {
+				return output(stdout, stderr, hostVars(res, conf))
+			}
 		}
 	}
 
@@ -318,6 +662,25 @@ func cmdHost(stdout io.Writer, stderr io.Writer, s *stateAnyTerraformVersion, ho
 	return 1
 }
 
+// hostVars returns the variables of a single host, i.e. all attributes of the
+// resource plus the address Ansible should connect to. By default, attributes
+// are flattened to dotted string keys (e.g. `tags.Name`) for compatibility;
+// the `typed` hostvars format keeps their original types and nesting.
+func hostVars(res *Resource, conf *Config) map[string]interface{} {
+	vars := make(map[string]interface{})
+	if conf.HostvarsFormat == HostvarsFormatTyped {
+		for k, v := range res.Values() {
+			vars[k] = v
+		}
+	} else {
+		for k, v := range res.Attributes() {
+			vars[k] = v
+		}
+	}
+	vars["ansible_host"] = res.Address()
+	return vars
+}
+
 // output marshals an arbitrary JSON object and writes it to stdout, or writes
 // an error to stderr, then returns the appropriate exit code.
 func output(stdout io.Writer, stderr io.Writer, whatever interface{}) int {
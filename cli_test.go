@@ -1 +1,387 @@
 package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+func readTestState(t *testing.T, content string, source string, name string) *stateAnyTerraformVersion {
+	s := &stateAnyTerraformVersion{Source: source, Name: name}
+	err := s.read(strings.NewReader(content), &Encryption{})
+	assert.NoError(t, err)
+	return s
+}
+
+// gatherTestGroups returns the groups of a single state.
+func gatherTestGroups(t *testing.T, s *stateAnyTerraformVersion, conf *Config, stderr io.Writer) map[string]interface{} {
+	namer, err := gatherGroups(s, conf, stderr)
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	return namer.output
+}
+
+func TestListCommandMultipleStates(t *testing.T) {
+	states := []*stateAnyTerraformVersion{
+		readTestState(t, exampleStateFileTerraformV4, "v4.tfstate", "aws"),
+		readTestState(t, exampleStateFileAzure, "azure.tfstate", "azure"),
+		readTestState(t, exampleStateFileEnvHostname, "libvirt.tfstate", ""),
+	}
+
+	var stdout, stderr bytes.Buffer
+	exitCode := cmdList(&stdout, &stderr, states, &Config{})
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, "7 group names aren't valid in Ansible, e.g. module_my-module-two, see group_names.sanitize\nstate azure.tfstate merging individual group legacy_0 [20.0.0.5] into the individual group legacy_0 [192.168.0.5]\n", stderr.String())
+
+	var act map[string]interface{}
+	err := json.Unmarshal(stdout.Bytes(), &act)
+	assert.NoError(t, err)
+
+	hostvars := act["_meta"].(map[string]interface{})["hostvars"].(map[string]interface{})
+	assert.Equal(t, "fourteen", hostvars["192.168.102.14"].(map[string]interface{})["name"])
+	assertHostvarsMatchHostCommandStates(t, states, act)
+
+	assert.Equal(t, []interface{}{"10.0.0.2", "10.0.0.4", "10.0.1.2", "10.1.0.6", "192.168.0.5", "192.168.102.14", "20.0.0.4", "20.0.0.5", "35.159.25.34"}, act["all"].(map[string]interface{})["hosts"])
+	assert.Equal(t, map[string]interface{}{"my_endpoint": "a.b.c.d.example.com", "my_password": "1234"}, act["all"].(map[string]interface{})["vars"])
+
+	// named states get a group of their own
+	assert.Equal(t, []interface{}{"10.0.0.2", "10.0.0.4", "10.0.1.2", "192.168.0.5", "35.159.25.34"}, act["aws"])
+	assert.Equal(t, []interface{}{"10.1.0.6", "20.0.0.4", "20.0.0.5"}, act["azure"])
+
+	// groups of the same name are merged
+	assert.Equal(t, []interface{}{"20.0.0.4", "35.159.25.34"}, act["role_web"])
+
+}
+
+func TestListCommandMultipleStatesCollisions(t *testing.T) {
+	changed := strings.Replace(exampleStateFileTerraformV4, `"ami": "ami-00000000000000000"`, `"ami": "ami-11111111111111111"`, 1)
+	changed = strings.Replace(changed, `"value": "a.b.c.d.example.com"`, `"value": "e.f.g.h.example.com"`, 1)
+	states := []*stateAnyTerraformVersion{
+		readTestState(t, exampleStateFileTerraformV4, "a.tfstate", ""),
+		readTestState(t, changed, "b.tfstate", "one"),
+	}
+
+	var stdout, stderr bytes.Buffer
+	exitCode := cmdList(&stdout, &stderr, states, &Config{})
+	assert.Equal(t, 0, exitCode)
+
+	assert.Equal(t, strings.Join([]string{
+		"7 group names aren't valid in Ansible, e.g. module_my-module-two, see group_names.sanitize",
+		"merging state group one [10.0.0.2 10.0.0.4 10.0.1.2 192.168.0.5 35.159.25.34] into the ordered group one [35.159.25.34]",
+		"7 group names aren't valid in Ansible, e.g. module_my-module-two, see group_names.sanitize",
+		"state b.tfstate defines host 35.159.25.34 differently, ignoring its host vars",
+		"state b.tfstate defines variable my_endpoint differently, ignoring it, old: a.b.c.d.example.com, new: e.f.g.h.example.com",
+		"",
+	}, "\n"), stderr.String())
+
+	var act map[string]interface{}
+	err := json.Unmarshal(stdout.Bytes(), &act)
+	assert.NoError(t, err)
+
+	hostvars := act["_meta"].(map[string]interface{})["hostvars"].(map[string]interface{})
+	assert.Equal(t, "ami-00000000000000000", hostvars["35.159.25.34"].(map[string]interface{})["ami"])
+	assert.Equal(t, []interface{}{"10.0.0.2", "10.0.0.4", "10.0.1.2", "192.168.0.5", "35.159.25.34"}, act["one"].(map[string]interface{})["hosts"])
+}
+
+func TestNamedStateGroupNames(t *testing.T) {
+	s := readTestState(t, exampleStateFileTerraformV4, "b.tfstate", "one")
+
+	// the group of a named state follows the collision policy
+	groups, err := gatherInventory([]*stateAnyTerraformVersion{s}, &Config{GroupNames: GroupNames{Collisions: GroupCollisionsPrefix}}, &bytes.Buffer{})
+	assert.NoError(t, err)
+	assert.Equal(t, &parentGroup{Hosts: []string{"35.159.25.34"}, Children: []string{"one_0"}}, groups["one"])
+	assert.Equal(t, []string{"10.0.0.2", "10.0.0.4", "10.0.1.2", "192.168.0.5", "35.159.25.34"}, groups["state_one"])
+
+	_, err = gatherInventory([]*stateAnyTerraformVersion{s}, &Config{GroupNames: GroupNames{Collisions: GroupCollisionsFail}}, &bytes.Buffer{})
+	assert.EqualError(t, err, "state b.tfstate: state group one collides with the ordered group one")
+
+	// and its name is sanitized and checked like the generated ones
+	s = readTestState(t, exampleStateFileTerraformV4, "b.tfstate", "eu-west")
+	var stderr bytes.Buffer
+	groups, err = gatherInventory([]*stateAnyTerraformVersion{s}, &Config{GroupNames: GroupNames{Sanitize: true}}, &stderr)
+	assert.NoError(t, err)
+	assert.Contains(t, groups, "eu_west")
+	assert.NotContains(t, groups, "eu-west")
+	assert.Equal(t, "", stderr.String())
+
+	stderr.Reset()
+	_, err = gatherInventory([]*stateAnyTerraformVersion{s}, &Config{}, &stderr)
+	assert.NoError(t, err)
+	assert.Equal(t, "8 group names aren't valid in Ansible, e.g. eu-west, see group_names.sanitize\n", stderr.String())
+}
+
+const expectedYAMLOutputEnvHostname = `all:
+  children:
+    fourteen:
+      children:
+        fourteen_0: null
+      hosts:
+        192.168.102.14: null
+    fourteen_0:
+      hosts:
+        192.168.102.14: null
+    terraform_types:
+      children:
+        type_libvirt_domain: null
+    type_libvirt_domain:
+      hosts:
+        192.168.102.14: null
+  hosts:
+    192.168.102.14:
+      ansible_host: 192.168.102.14
+      name: fourteen
+      network_interface.#: "1"
+      network_interface.0.addresses.#: "1"
+      network_interface.0.addresses.0: 192.168.102.14
+      network_interface.0.mac: 96:EE:4D:BD:B2:45
+`
+
+func TestYAMLCommand(t *testing.T) {
+	s := readTestState(t, exampleStateFileEnvHostname, "libvirt.tfstate", "")
+
+	var stdout, stderr bytes.Buffer
+	exitCode := cmdYAML(&stdout, &stderr, []*stateAnyTerraformVersion{s}, &Config{})
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, "", stderr.String())
+	assert.Equal(t, expectedYAMLOutputEnvHostname, stdout.String())
+}
+
+func TestYAMLCommandMatchesListCommand(t *testing.T) {
+	s := readTestState(t, exampleStateFileTerraformV4, "v4.tfstate", "")
+	states := []*stateAnyTerraformVersion{s}
+
+	var stdout, stderr bytes.Buffer
+	exitCode := cmdYAML(&stdout, &stderr, states, &Config{})
+	assert.Equal(t, 0, exitCode)
+
+	var act struct {
+		All struct {
+			Hosts    map[string]map[string]interface{} `yaml:"hosts"`
+			Vars     map[string]interface{}            `yaml:"vars"`
+			Children map[string]struct {
+				Hosts    map[string]interface{} `yaml:"hosts"`
+				Children map[string]interface{} `yaml:"children"`
+			} `yaml:"children"`
+		} `yaml:"all"`
+	}
+	err := yaml.Unmarshal(stdout.Bytes(), &act)
+	assert.NoError(t, err)
+
+	stdout.Reset()
+	exitCode = cmdList(&stdout, &stderr, states, &Config{})
+	assert.Equal(t, 0, exitCode)
+	var list map[string]interface{}
+	err = json.Unmarshal(stdout.Bytes(), &list)
+	assert.NoError(t, err)
+
+	// Every group of the JSON inventory is a child of all, with the same hosts
+	// and children
+	assert.Len(t, act.All.Children, len(list)-2)
+	for name, grp := range list {
+		if name == "all" || name == "_meta" {
+			continue
+		}
+		var hosts, children []interface{}
+		for host := range act.All.Children[name].Hosts {
+			hosts = append(hosts, host)
+		}
+		for child := range act.All.Children[name].Children {
+			children = append(children, child)
+		}
+		if parent, isParent := grp.(map[string]interface{}); isParent {
+			assert.ElementsMatch(t, parent["hosts"], hosts, name)
+			assert.ElementsMatch(t, parent["children"], children, name)
+		} else {
+			assert.ElementsMatch(t, grp, hosts, name)
+			assert.Empty(t, children, name)
+		}
+	}
+
+	assert.Equal(t, map[string]interface{}{"my_endpoint": "a.b.c.d.example.com", "my_password": "1234"}, act.All.Vars)
+	hostvars := list["_meta"].(map[string]interface{})["hostvars"].(map[string]interface{})
+	assert.Len(t, act.All.Hosts, len(hostvars))
+	assert.Equal(t, "ami-00000000000000000", act.All.Hosts["35.159.25.34"]["ami"])
+}
+
+func TestPythonLiteral(t *testing.T) {
+	assert.Equal(t, `"10.0.0.1"`, pythonLiteral("10.0.0.1"))
+	assert.Equal(t, `"1"`, pythonLiteral("1"))
+	assert.Equal(t, `"<0.7_format"`, pythonLiteral("<0.7_format"))
+	assert.Equal(t, `"it's \"quoted\""`, pythonLiteral(`it's "quoted"`))
+	assert.Equal(t, `1.5`, pythonLiteral(1.5))
+	assert.Equal(t, `True`, pythonLiteral(true))
+	assert.Equal(t, `None`, pythonLiteral(nil))
+	assert.Equal(t, `[1,"a",False]`, pythonLiteral([]interface{}{1.0, "a", false}))
+	assert.Equal(t, `{"a":None,"b":{"c":[]}}`, pythonLiteral(map[string]interface{}{
+		"b": map[string]interface{}{"c": []interface{}{}},
+		"a": nil,
+	}))
+}
+
+func TestShellQuote(t *testing.T) {
+	assert.Equal(t, "tags.Name", shellQuote("tags.Name"))
+	assert.Equal(t, "1", shellQuote("1"))
+	assert.Equal(t, "'tags.#'", shellQuote("tags.#"))
+	assert.Equal(t, `'"a b"'`, shellQuote(`"a b"`))
+	assert.Equal(t, `'"it'"'"'s"'`, shellQuote(`"it's"`))
+	assert.Equal(t, "''", shellQuote(""))
+}
+
+func TestINIInventoryHostVarsAndChildren(t *testing.T) {
+	groups := map[string]interface{}{
+		"all": &allGroup{
+			Hosts: []string{"10.0.0.1", "10.0.0.2"},
+			Vars:  map[string]interface{}{"enabled": true},
+		},
+		"_meta": &metaGroup{Hostvars: map[string]map[string]interface{}{
+			"10.0.0.1": {"ansible_host": "10.0.0.1", "name": "it's web", "tags.#": "1", "tags.Name": "it's web"},
+			"10.0.0.2": {"ansible_host": "10.0.0.2", "ports": []interface{}{80.0, 443.0}, "memory": "<error>"},
+		}},
+		"role_db":  []string{"10.0.0.2"},
+		"role_web": []string{"10.0.0.1"},
+		"role":     &parentGroup{Children: []string{"role_db", "role_web"}},
+	}
+
+	var stdout, stderr bytes.Buffer
+	exitCode := writeINIInventory(&stdout, &stderr, groups, INI{HostVars: []string{"*"}})
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, "", stderr.String())
+	assert.Equal(t, `[all]
+10.0.0.1 ansible_host='"10.0.0.1"' name='"it'"'"'s web"'
+10.0.0.2 ansible_host='"10.0.0.2"' ports='[80,443]'
+
+[all:vars]
+enabled=True
+
+[role]
+
+[role:children]
+role_db
+role_web
+
+[role_db]
+10.0.0.2
+
+[role_web]
+10.0.0.1
+
+`, stdout.String())
+}
+
+func TestINIInventoryDefaultHostVars(t *testing.T) {
+	groups := map[string]interface{}{
+		"all": &allGroup{Hosts: []string{"10.0.0.1"}, Vars: map[string]interface{}{}},
+		"_meta": &metaGroup{Hostvars: map[string]map[string]interface{}{
+			"10.0.0.1": {"ansible_host": "10.0.0.1", "id": "i-aaaaaaaa", "private_ip": "10.0.0.1"},
+		}},
+	}
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 0, writeINIInventory(&stdout, &stderr, groups, INI{}))
+	assert.Equal(t, "[all]\n10.0.0.1 ansible_host='\"10.0.0.1\"'\n\n[all:vars]\n\n", stdout.String())
+
+	stdout.Reset()
+	assert.Equal(t, 0, writeINIInventory(&stdout, &stderr, groups, INI{HostVars: []string{"ansible_host", "private_*"}}))
+	assert.Equal(t, "[all]\n10.0.0.1 ansible_host='\"10.0.0.1\"' private_ip='\"10.0.0.1\"'\n\n[all:vars]\n\n", stdout.String())
+}
+
+func TestGroupHierarchy(t *testing.T) {
+	s := readTestState(t, exampleStateFileTerraformV4, "v4.tfstate", "")
+
+	groups := gatherTestGroups(t, s, &Config{}, &bytes.Buffer{})
+	assert.Equal(t, &parentGroup{Children: []string{"role_web", "role_worker"}}, groups["role"])
+	assert.Equal(t, &parentGroup{Hosts: []string{"10.0.0.2", "10.0.1.2"}, Children: []string{"module_my-module-two_host_0", "module_my-module-two_host_1"}}, groups["module_my-module-two_host"])
+	assert.Equal(t, &parentGroup{Children: []string{"type_aws_instance", "type_digitalocean_droplet"}}, groups["terraform_types"])
+
+	groups = gatherTestGroups(t, s, &Config{DisableGroups: []string{"hierarchy"}}, &bytes.Buffer{})
+	assert.NotContains(t, groups, "role")
+	assert.NotContains(t, groups, "terraform_types")
+	assert.Equal(t, []string{"10.0.0.2", "10.0.1.2"}, groups["module_my-module-two_host"])
+
+	// without the individual groups, the ordered groups have no children
+	groups = gatherTestGroups(t, s, &Config{DisableGroups: []string{"individual"}}, &bytes.Buffer{})
+	assert.Equal(t, []string{"10.0.0.2", "10.0.1.2"}, groups["module_my-module-two_host"])
+}
+
+const exampleStateFileTagKeyClash = `
+{
+	"version": 4,
+	"terraform_version": "1.5.7",
+	"resources": [
+		{
+			"mode": "managed",
+			"type": "aws_instance",
+			"name": "role",
+			"instances": [
+				{"attributes": {"id": "i-0", "private_ip": "10.0.0.1", "tags": {"Role": "web"}}}
+			]
+		},
+		{
+			"mode": "managed",
+			"type": "aws_instance",
+			"name": "db",
+			"instances": [
+				{"attributes": {"id": "i-1", "private_ip": "10.0.0.2", "tags": {"Role": "db"}}}
+			]
+		}
+	]
+}
+`
+
+func TestGroupHierarchyParentClash(t *testing.T) {
+	s := readTestState(t, exampleStateFileTagKeyClash, "clash.tfstate", "")
+
+	// the ordered group `role` keeps its meaning, the parent of the tag groups
+	// is prefixed with its family
+	var stderr bytes.Buffer
+	groups := gatherTestGroups(t, s, &Config{}, &stderr)
+	assert.Equal(t, &parentGroup{Hosts: []string{"10.0.0.1"}, Children: []string{"role_0"}}, groups["role"])
+	assert.Equal(t, &parentGroup{Children: []string{"role_db", "role_web"}}, groups["tags_role"])
+	assert.Equal(t, "adding parent group role of the tags groups [role_db role_web] as tags_role, the name role is taken by the ordered group\n", stderr.String())
+
+	// the collision policy applies to parents, too
+	stderr.Reset()
+	groups = gatherTestGroups(t, s, &Config{GroupNames: GroupNames{Collisions: GroupCollisionsPrefix}}, &stderr)
+	assert.Equal(t, &parentGroup{Children: []string{"role_db", "role_web"}}, groups["tags_role"])
+	assert.Equal(t, "", stderr.String())
+
+	_, err := gatherGroups(s, &Config{GroupNames: GroupNames{Collisions: GroupCollisionsFail}}, &bytes.Buffer{})
+	assert.EqualError(t, err, "parent group role of the tags groups [role_db role_web] collides with the ordered group role")
+}
+
+func TestGatherInventoryCollisions(t *testing.T) {
+	states := []*stateAnyTerraformVersion{
+		readTestState(t, strings.Replace(exampleStateFileTagKeyClash, `"name": "role"`, `"name": "app"`, 1), "a.tfstate", ""),
+		readTestState(t, strings.Replace(exampleStateFileTagKeyClash, "10.0.0.", "10.1.0.", -1), "b.tfstate", ""),
+	}
+
+	// the individual groups of different hosts are merged and reported, and
+	// the ordered group `role` isn't merged into the parent `role`
+	var stderr bytes.Buffer
+	groups, err := gatherInventory(states, &Config{}, &stderr)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.2", "10.1.0.2"}, groups["db_0"])
+	assert.Equal(t, &parentGroup{Children: []string{"role_db", "role_web"}}, groups["role"])
+	assert.Equal(t, &parentGroup{Hosts: []string{"10.1.0.1"}, Children: []string{"role_0"}}, groups["ordered_role"])
+	assert.Equal(t, strings.Join([]string{
+		"adding parent group role of the tags groups [role_db role_web] as tags_role, the name role is taken by the ordered group",
+		"state b.tfstate merging individual group db_0 [10.1.0.2] into the individual group db_0 [10.0.0.2]",
+		"state b.tfstate adding ordered group role as ordered_role, the name role is taken by the tags group",
+		"",
+	}, "\n"), stderr.String())
+
+	_, err = gatherInventory(states, &Config{DisableGroups: []string{"hierarchy"}, GroupNames: GroupNames{Collisions: GroupCollisionsFail}}, &bytes.Buffer{})
+	assert.EqualError(t, err, "state b.tfstate: individual group db_0 collides with the individual group db_0 of another state")
+
+	// reading the same state twice isn't a collision
+	stderr.Reset()
+	_, err = gatherInventory([]*stateAnyTerraformVersion{states[0], states[0]}, &Config{GroupNames: GroupNames{Collisions: GroupCollisionsFail}}, &stderr)
+	assert.NoError(t, err)
+	assert.Equal(t, "", stderr.String())
+}
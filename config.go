@@ -0,0 +1,303 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/blang/vfs"
+	"gopkg.in/yaml.v2"
+)
+
+// groupFamilies are the names of the built-in group families, which can be
+// disabled in the config file.
+var groupFamilies = []string{
+	"individual", // <name>_<count>
+	"ordered",    // <name>
+	"types",      // type_<type>
+	"tags",       // <key>_<value>
+	"modules",    // module_<name>
+	"placement",  // <attribute>_<value>, e.g. availability_zone_us_east_1a
+	"hierarchy",  // parents of the groups above, e.g. <key> of <key>_<value>
+}
+
+// HostvarsFormat defines how the attributes of a resource are turned into host
+// vars.
+type HostvarsFormat string
+
+const (
+	// HostvarsFormatFlat means that attributes are flattened to dotted string
+	// keys, e.g. `tags.Name`.
+	HostvarsFormatFlat HostvarsFormat = "flat"
+
+	// HostvarsFormatTyped means that attributes keep their original types and
+	// nesting. States older than Terraform 0.12 only have flat attributes.
+	HostvarsFormatTyped HostvarsFormat = "typed"
+)
+
+// Config holds the settings read from the optional config file. The zero value
+// is the default configuration.
+type Config struct {
+
+	// Additional groups, built from the rules below.
+	Groups []GroupRule `yaml:"groups"`
+
+	// Names of the built-in group families which should not be emitted.
+	DisableGroups []string `yaml:"disable_groups"`
+
+	// How to name the generated groups.
+	GroupNames GroupNames `yaml:"group_names"`
+
+	// Format of the host vars, `flat` (the default) or `typed`.
+	HostvarsFormat HostvarsFormat `yaml:"hostvars_format"`
+
+	// (Flattened) attributes to group hosts by, e.g. `availability_zone`. If
+	// set, they replace the placement attributes of all providers.
+	PlacementAttributes []string `yaml:"placement_attributes"`
+
+	// Additional providers. They take precedence over the built-in providers
+	// for the same resource types.
+	Providers []*Provider `yaml:"providers"`
+
+	// How to run Terraform for Terraform project directories.
+	Terraform Terraform `yaml:"terraform"`
+
+	// How to decrypt encrypted states.
+	Encryption Encryption `yaml:"encryption"`
+
+	// How to write the INI inventory of `--inventory`.
+	INI INI `yaml:"ini"`
+
+	// How to write the SSH config of the `ssh` output format.
+	SSH SSH `yaml:"ssh"`
+
+	// How to write the targets of the `prometheus` output format.
+	Prometheus Prometheus `yaml:"prometheus"`
+}
+
+// INI holds how the INI inventory is written.
+type INI struct {
+
+	// Host vars to write on the host lines, as glob patterns, e.g. `private_*`. By
+	// default only `ansible_host` is written.
+	HostVars []string `yaml:"host_vars"`
+}
+
+// hostVars returns the patterns of the host vars to write on the host lines.
+func (i INI) hostVars() []string {
+	if len(i.HostVars) == 0 {
+		return []string{"ansible_host"}
+	}
+	return i.HostVars
+}
+
+// GroupRule puts every resource which matches all of the given conditions into
+// the group Name. Conditions which are not set always match. Patterns use the
+// syntax of path.Match, e.g. `aws_*`.
+type GroupRule struct {
+	Name string `yaml:"name"`
+
+	// Pattern for the resource type, e.g. `aws_instance`
+	Type string `yaml:"type"`
+
+	// Pattern for the address of the module containing the resource, e.g.
+	// `module.db`. The root module has an empty address.
+	Module string `yaml:"module"`
+
+	// Pattern for the address of the resource, e.g. `module.db.aws_instance.*`
+	Address string `yaml:"address"`
+
+	// Patterns for the values of (flattened) attributes, e.g.
+	// `instance_type: t3.*` or `root_block_device.0.volume_type: gp3`
+	Attributes map[string]string `yaml:"attributes"`
+
+	// Patterns for the values of tags. Tags are lower-cased, so the patterns are
+	// matched case-insensitively.
+	Tags map[string]string `yaml:"tags"`
+}
+
+// LoadConfig reads and validates the config file at the given path.
+func LoadConfig(fs vfs.Filesystem, filename string) (*Config, error) {
+	b, err := vfs.ReadFile(fs, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Config{}
+	err = yaml.UnmarshalStrict(b, c)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+
+	err = c.validate()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+
+	return c, nil
+}
+
+func (c *Config) validate() error {
+	for _, family := range c.DisableGroups {
+		if !contains(groupFamilies, family) {
+			return fmt.Errorf("unknown group family %q in disable_groups (valid: %s)", family, strings.Join(groupFamilies, ", "))
+		}
+	}
+
+	if r := c.GroupNames.Replacement; r != "" && (GroupNames{Sanitize: true}).sanitize(r) != r {
+		return fmt.Errorf("group_names replacement %q is not valid in group names", r)
+	}
+	if f := c.HostvarsFormat; f != "" && f != HostvarsFormatFlat && f != HostvarsFormatTyped {
+		return fmt.Errorf("unknown hostvars_format %q (valid: %s, %s)", f, HostvarsFormatFlat, HostvarsFormatTyped)
+	}
+
+	switch c.GroupNames.Collisions {
+	case "", GroupCollisionsMerge, GroupCollisionsPrefix, GroupCollisionsFail:
+	default:
+		return fmt.Errorf("unknown group_names collisions %q (valid: %s, %s, %s)", c.GroupNames.Collisions, GroupCollisionsMerge, GroupCollisionsPrefix, GroupCollisionsFail)
+	}
+
+	for i, rule := range c.Groups {
+		if rule.Name == "" {
+			return fmt.Errorf("group rule #%d has no name", i+1)
+		}
+
+		patterns := []string{rule.Type, rule.Module, rule.Address}
+		for _, v := range rule.Attributes {
+			patterns = append(patterns, v)
+		}
+		for _, v := range rule.Tags {
+			patterns = append(patterns, v)
+		}
+		for _, p := range patterns {
+			if _, err := path.Match(p, ""); err != nil {
+				return fmt.Errorf("group rule %q has invalid pattern %q", rule.Name, p)
+			}
+		}
+	}
+
+	for i, p := range c.Providers {
+		if len(p.ResourceTypes) == 0 {
+			return fmt.Errorf("provider #%d has no resource_types", i+1)
+		}
+		if p.TagStyle != "" && p.TagStyle != TagStyleKeyValue && p.TagStyle != TagStyleValue {
+			return fmt.Errorf("provider #%d has unknown tag_style %q (valid: %s, %s)", i+1, p.TagStyle, TagStyleKeyValue, TagStyleValue)
+		}
+	}
+
+	for _, p := range c.INI.HostVars {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("ini host_vars has invalid pattern %q", p)
+		}
+	}
+
+	if g := c.Prometheus.GroupBy; g != "" && g != "type" && g != "group" {
+		return fmt.Errorf("unknown prometheus group_by %q (valid: type, group)", g)
+	}
+	if c.Prometheus.Port < 0 || c.Prometheus.Port > 65535 {
+		return fmt.Errorf("invalid prometheus port %d", c.Prometheus.Port)
+	}
+
+	return nil
+}
+
+// groupEnabled returns whether the given built-in group family should be
+// emitted.
+func (c *Config) groupEnabled(family string) bool {
+	return !contains(c.DisableGroups, family)
+}
+
+// groupsFor returns the names of the groups from the config file which the
+// given resource belongs to.
+func (c *Config) groupsFor(r *Resource) []string {
+	var names []string
+
+	for _, rule := range c.Groups {
+		if rule.matches(r) {
+			names = append(names, rule.Name)
+		}
+	}
+
+	return names
+}
+
+// placementGroups returns the names of the placement groups (e.g.
+// `availability_zone_us_east_1a`) of the given resource, mapped to their
+// attribute names (e.g. `availability_zone`). As the values are hardly ever
+// valid in group names, the names are always sanitized.
+func (c *Config) placementGroups(r *Resource) map[string]string {
+	attrs := c.PlacementAttributes
+	if len(attrs) == 0 {
+		attrs = providers.placementAttributes(r.resourceType)
+	}
+
+	sanitize := GroupNames{Sanitize: true, Replacement: c.GroupNames.Replacement}
+	groups := make(map[string]string)
+	attributes := r.Attributes()
+	for _, attr := range attrs {
+		if v := attributes[attr]; v != "" {
+			// nested attributes are named after their last part
+			key := sanitize.sanitize(attr[strings.LastIndex(attr, ".")+1:])
+			groups[sanitize.sanitize(fmt.Sprintf("%s_%s", key, v))] = key
+		}
+	}
+
+	return groups
+}
+
+func (rule GroupRule) matches(r *Resource) bool {
+	if rule.Type != "" && !match(rule.Type, r.resourceType) {
+		return false
+	}
+
+	if rule.Module != "" && !match(rule.Module, r.moduleAddress) {
+		return false
+	}
+
+	if rule.Address != "" && !match(rule.Address, r.address) {
+		return false
+	}
+
+	attributes := r.Attributes()
+	for k, pattern := range rule.Attributes {
+		v, exists := attributes[k]
+		if !exists || !match(pattern, v) {
+			return false
+		}
+	}
+
+	tags := r.Tags()
+	for k, pattern := range rule.Tags {
+		v, exists := tags[strings.ToLower(k)]
+		if !exists || !match(strings.ToLower(pattern), v) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// match is path.Match for patterns which have already been validated.
+func match(pattern, name string) bool {
+	matched, _ := path.Match(pattern, name)
+	return matched
+}
+
+// matchAny returns whether the name matches one of the given patterns.
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if match(p, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(strs []string, item string) bool {
+	for _, s := range strs {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/blang/vfs/memfs"
+	"github.com/stretchr/testify/assert"
+)
+
+const exampleConfigFile = `
+disable_groups:
+  - individual
+  - tags
+groups:
+  - name: databases
+    module: module.*.module.db
+  - name: workers
+    tags:
+      Role: Worker
+  - name: first_hosts
+    address: "*.aws_instance.host[[]0]"
+  - name: droplets_and_public
+    type: digitalocean_*
+  - name: public
+    attributes:
+      public_ip: "*"
+`
+
+const expectedListOutputWithConfig = `
+{
+	"all": {
+		"hosts": [
+			"10.0.0.2",
+			"10.0.0.4",
+			"10.0.1.2",
+			"192.168.0.5",
+			"35.159.25.34"
+		],
+		"vars": {
+			"my_endpoint": "a.b.c.d.example.com",
+			"my_password": "1234"
+		}
+	},
+	"one": ["35.159.25.34"],
+	"legacy": ["192.168.0.5"],
+	"module_my-module-two_host": ["10.0.0.2", "10.0.1.2"],
+	"module_my-module-two_module_db_host": ["10.0.0.4"],
+
+	"type_aws_instance": ["10.0.0.2", "10.0.0.4", "10.0.1.2", "35.159.25.34"],
+	"type_digitalocean_droplet": ["192.168.0.5"],
+
+	"databases": ["10.0.0.4"],
+	"workers": ["10.0.0.2", "10.0.1.2"],
+	"first_hosts": ["10.0.0.2"],
+	"droplets_and_public": ["192.168.0.5"],
+	"public": ["35.159.25.34"],
+
+	"terraform_types": {"children": ["type_aws_instance", "type_digitalocean_droplet"]},
+
+	"module_my-module-two": ["10.0.0.2", "10.0.0.4", "10.0.1.2"],
+	"module_my-module-two_module_db": ["10.0.0.4"]
+}
+`
+
+func TestLoadConfig(t *testing.T) {
+	fs := memfs.Create()
+	err := writeFile(fs, "/terraform-inventory.yml", []byte(exampleConfigFile), 0600)
+	assert.NoError(t, err)
+
+	c, err := LoadConfig(fs, "/terraform-inventory.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"individual", "tags"}, c.DisableGroups)
+	assert.Len(t, c.Groups, 5)
+	assert.Equal(t, GroupRule{Name: "workers", Tags: map[string]string{"Role": "Worker"}}, c.Groups[1])
+
+	assert.False(t, c.groupEnabled("individual"))
+	assert.True(t, c.groupEnabled("ordered"))
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	for _, content := range []string{
+		"disable_groups: [nope]",
+		"groups: [{type: aws_instance}]",
+		"groups: [{name: x, address: '[' }]",
+		"groupz: []",
+		"prometheus: {group_by: host}",
+		"prometheus: {port: 70000}",
+		"hostvars_format: nested",
+		"group_names: {collisions: overwrite}",
+		"group_names: {replacement: '-'}",
+		"ini: {host_vars: ['[']}",
+	} {
+		fs := memfs.Create()
+		err := writeFile(fs, "/terraform-inventory.yml", []byte(content), 0600)
+		assert.NoError(t, err)
+
+		_, err = LoadConfig(fs, "/terraform-inventory.yml")
+		assert.Error(t, err, content)
+	}
+}
+
+func TestListCommandWithConfig(t *testing.T) {
+	var s stateAnyTerraformVersion
+	r := strings.NewReader(exampleStateFileTerraformV4)
+	err := s.read(r, &Encryption{})
+	assert.NoError(t, err)
+
+	fs := memfs.Create()
+	err = writeFile(fs, "/terraform-inventory.yml", []byte(exampleConfigFile), 0600)
+	assert.NoError(t, err)
+	c, err := LoadConfig(fs, "/terraform-inventory.yml")
+	assert.NoError(t, err)
+
+	// Decode expectation as JSON
+	var exp interface{}
+	err = json.Unmarshal([]byte(expectedListOutputWithConfig), &exp)
+	assert.NoError(t, err)
+
+	// Run the command, capture the output
+	var stdout, stderr bytes.Buffer
+	exitCode := cmdList(&stdout, &stderr, []*stateAnyTerraformVersion{&s}, c)
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, "4 group names aren't valid in Ansible, e.g. module_my-module-two, see group_names.sanitize\n", stderr.String())
+
+	// Decode the output to compare
+	var act interface{}
+	err = json.Unmarshal([]byte(stdout.String()), &act)
+	assert.NoError(t, err)
+
+	assertHostvarsMatchHostCommand(t, &s, act)
+	assert.Equal(t, exp, act)
+}
+
+func TestResourceAddressPre0dot12(t *testing.T) {
+	s := state{Modules: []moduleState{
+		{
+			Path: []string{"root", "app", "db"},
+			ResourceStates: map[string]resourceState{
+				"aws_instance.host.1": {
+					Type:    "aws_instance",
+					Primary: instanceState{ID: "i-1", Attributes: map[string]string{"private_ip": "10.0.0.1"}},
+				},
+			},
+		},
+	}}
+
+	resources := s.resources()
+	assert.Len(t, resources, 1)
+	assert.Equal(t, "module.app.module.db", resources[0].moduleAddress)
+	assert.Equal(t, "module.app.module.db.aws_instance.host[1]", resources[0].address)
+}
+
+const exampleConfigFileProviders = `
+providers:
+  - name: Private Cloud
+    resource_types: [privcloud_vm]
+    address_attributes: [nic.0.ip, nic.1.ip]
+    hostname_attributes: [fqdn]
+    tag_attributes: [labels]
+    tag_style: key_value
+  - name: libvirt fork
+    resource_types: [libvirt_domain]
+    address_attributes: [network_interface.0.addresses.1]
+    tag_attributes: [roles]
+    tag_style: value
+`
+
+func TestUserDefinedProviders(t *testing.T) {
+	defer func(pr *providerRegistry) { providers = pr }(providers)
+	providers = newProviderRegistry(builtinProviders)
+
+	fs := memfs.Create()
+	err := writeFile(fs, "/terraform-inventory.yml", []byte(exampleConfigFileProviders), 0600)
+	assert.NoError(t, err)
+
+	c, err := LoadConfig(fs, "/terraform-inventory.yml")
+	assert.NoError(t, err)
+	assert.Len(t, c.Providers, 2)
+	for _, p := range c.Providers {
+		providers.register(p)
+	}
+
+	r, err := NewResource("privcloud_vm.web", resourceState{
+		Type: "privcloud_vm",
+		Primary: instanceState{Attributes: map[string]string{
+			"fqdn":        "web.example.com",
+			"nic.#":       "2",
+			"nic.1.ip":    "10.0.0.2",
+			"labels.%":    "1",
+			"labels.Role": "Web",
+		}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.2", r.Address())
+	assert.Equal(t, "web.example.com", r.Hostname())
+	assert.Equal(t, map[string]string{"role": "web"}, r.Tags())
+
+	// Without a hostname attribute, the address is the hostname
+	delete(r.State.Primary.Attributes, "fqdn")
+	assert.Equal(t, "10.0.0.2", r.Hostname())
+
+	// User-defined providers take precedence over built-in ones
+	r, err = NewResource("libvirt_domain.db", resourceState{
+		Type: "libvirt_domain",
+		Primary: instanceState{Attributes: map[string]string{
+			"network_interface.0.addresses.0": "fe80::1",
+			"network_interface.0.addresses.1": "192.168.102.15",
+			"roles.#":                         "1",
+			"roles.0":                         "db",
+		}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "192.168.102.15", r.Address())
+	assert.Equal(t, map[string]string{"db": ""}, r.Tags())
+}
+
+func TestLoadConfigInvalidProviders(t *testing.T) {
+	for _, content := range []string{
+		"providers: [{name: x}]",
+		"providers: [{resource_types: [x_vm], tag_style: kv}]",
+	} {
+		fs := memfs.Create()
+		err := writeFile(fs, "/terraform-inventory.yml", []byte(content), 0600)
+		assert.NoError(t, err)
+
+		_, err = LoadConfig(fs, "/terraform-inventory.yml")
+		assert.Error(t, err, content)
+	}
+}
+
+func TestLoadConfigTerraform(t *testing.T) {
+	fs := memfs.Create()
+	err := writeFile(fs, "/terraform-inventory.yml", []byte(`
+terraform:
+  binary: tofu
+  args: [-chdir=infra]
+  env:
+    TF_DATA_DIR: .tofu
+`), 0600)
+	assert.NoError(t, err)
+
+	c, err := LoadConfig(fs, "/terraform-inventory.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, Terraform{
+		Binary: "tofu",
+		Args:   []string{"-chdir=infra"},
+		Env:    map[string]string{"TF_DATA_DIR": ".tofu"},
+	}, c.Terraform)
+}
+
+func TestLoadConfigSSH(t *testing.T) {
+	fs := memfs.Create()
+	err := writeFile(fs, "/terraform-inventory.yml", []byte(`
+ssh:
+  user:
+    tags: [login]
+    default: ubuntu
+  proxy_jump:
+    attributes: [tags.Bastion]
+`), 0600)
+	assert.NoError(t, err)
+
+	c, err := LoadConfig(fs, "/terraform-inventory.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, SSH{
+		User:      SSHOption{Tags: []string{"login"}, Default: "ubuntu"},
+		ProxyJump: SSHOption{Attributes: []string{"tags.Bastion"}},
+	}, c.SSH)
+}
+
+func TestModuleGroups(t *testing.T) {
+	s := state{Modules: []moduleState{
+		{
+			Path: []string{"root", "application1", "db"},
+			ResourceStates: map[string]resourceState{
+				"aws_instance.host": {
+					Type:    "aws_instance",
+					Primary: instanceState{ID: "i-1", Attributes: map[string]string{"private_ip": "10.0.0.1"}},
+				},
+			},
+		},
+	}}
+
+	sv := &stateAnyTerraformVersion{TerraformVersion: TerraformVersionPre0dot12, StatePre0dot12: s}
+	groups := gatherTestGroups(t, sv, &Config{}, &bytes.Buffer{})
+	assert.Equal(t, []string{"10.0.0.1"}, groups["module_application1"])
+	assert.Equal(t, []string{"10.0.0.1"}, groups["module_application1_module_db"])
+
+	groups = gatherTestGroups(t, sv, &Config{DisableGroups: []string{"modules"}}, &bytes.Buffer{})
+	assert.NotContains(t, groups, "module_application1")
+
+	for address, expected := range map[string][]string{
+		"":                                nil,
+		"module.app":                      {"module_app"},
+		"module.app[0].module.db":         {"module_app", "module_app_0", "module_app_0_module_db"},
+		`module.app["eu.west"]`:           {"module_app", "module_app_eu_west"},
+		`module.a.module.b["x"].module.c`: {"module_a", "module_a_module_b", "module_a_module_b_x", "module_a_module_b_x_module_c"},
+	} {
+		r := Resource{moduleAddress: address}
+		assert.Equal(t, expected, r.moduleGroups(), address)
+	}
+}
+
+const exampleStateFileModuleInstances = `
+{
+	"version": 4,
+	"terraform_version": "1.5.7",
+	"resources": [
+		{
+			"mode": "managed",
+			"type": "aws_instance",
+			"name": "web",
+			"instances": [{"attributes": {"id": "i-0", "private_ip": "10.0.0.1"}}]
+		},
+		{
+			"module": "module.app[0]",
+			"mode": "managed",
+			"type": "aws_instance",
+			"name": "host",
+			"instances": [{"attributes": {"id": "i-1", "private_ip": "10.0.1.1"}}]
+		},
+		{
+			"module": "module.app[\"x\"]",
+			"mode": "managed",
+			"type": "aws_instance",
+			"name": "host",
+			"instances": [
+				{"index_key": 0, "attributes": {"id": "i-2", "private_ip": "10.0.2.1"}},
+				{"index_key": 1, "attributes": {"id": "i-3", "private_ip": "10.0.2.2"}}
+			]
+		}
+	]
+}
+`
+
+func TestListCommandModuleInstances(t *testing.T) {
+	s := readTestState(t, exampleStateFileModuleInstances, "modules.tfstate", "")
+
+	var stdout, stderr bytes.Buffer
+	exitCode := cmdList(&stdout, &stderr, []*stateAnyTerraformVersion{s}, &Config{})
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, "", stderr.String())
+
+	var act map[string]interface{}
+	assert.NoError(t, json.Unmarshal(stdout.Bytes(), &act))
+	assert.Equal(t, []interface{}{"10.0.0.1", "10.0.1.1", "10.0.2.1", "10.0.2.2"}, act["all"].(map[string]interface{})["hosts"])
+	assert.Equal(t, []interface{}{"10.0.1.1", "10.0.2.1", "10.0.2.2"}, act["module_app"])
+	assert.Equal(t, []interface{}{"10.0.1.1"}, act["module_app_0"])
+	assert.Equal(t, []interface{}{"10.0.2.1", "10.0.2.2"}, act["module_app_x"])
+	assert.Equal(t, []interface{}{"10.0.1.1"}, act["module_app_0_host_0"])
+	assert.Equal(t, []interface{}{"10.0.2.2"}, act["module_app_x_host_1"])
+}
+
+func TestPlacementGroups(t *testing.T) {
+	s := state{Modules: []moduleState{
+		{
+			Path: []string{"root"},
+			ResourceStates: map[string]resourceState{
+				"aws_instance.web.0": {
+					Type: "aws_instance",
+					Primary: instanceState{ID: "i-0", Attributes: map[string]string{
+						"private_ip":                   "10.0.0.1",
+						"availability_zone":            "us-east-1a",
+						"instance_type":                "t3.large",
+						"placement.0.partition_number": "2",
+					}},
+				},
+				"aws_instance.web.1": {
+					Type: "aws_instance",
+					Primary: instanceState{ID: "i-1", Attributes: map[string]string{
+						"private_ip":        "10.0.0.2",
+						"availability_zone": "us-east-1b",
+						"instance_type":     "t3.large",
+					}},
+				},
+			},
+		},
+	}}
+
+	sv := &stateAnyTerraformVersion{TerraformVersion: TerraformVersionPre0dot12, StatePre0dot12: s}
+	groups := gatherTestGroups(t, sv, &Config{}, &bytes.Buffer{})
+	assert.Equal(t, []string{"10.0.0.1"}, groups["availability_zone_us_east_1a"])
+	assert.Equal(t, []string{"10.0.0.2"}, groups["availability_zone_us_east_1b"])
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, groups["instance_type_t3_large"])
+	assert.Equal(t, &parentGroup{Children: []string{"availability_zone_us_east_1a", "availability_zone_us_east_1b"}}, groups["availability_zone"])
+	assert.NotContains(t, groups, "partition_number_2")
+
+	// the placement values are sanitized with the configured replacement
+	groups = gatherTestGroups(t, sv, &Config{GroupNames: GroupNames{Replacement: "x"}}, &bytes.Buffer{})
+	assert.Equal(t, []string{"10.0.0.1"}, groups["availability_zone_usxeastx1a"])
+
+	// configured attributes replace the ones of the provider
+	groups = gatherTestGroups(t, sv, &Config{PlacementAttributes: []string{"placement.0.partition_number"}}, &bytes.Buffer{})
+	assert.Equal(t, []string{"10.0.0.1"}, groups["partition_number_2"])
+	assert.NotContains(t, groups, "instance_type_t3_large")
+
+	groups = gatherTestGroups(t, sv, &Config{DisableGroups: []string{"placement"}}, &bytes.Buffer{})
+	assert.NotContains(t, groups, "instance_type_t3_large")
+	assert.NotContains(t, groups, "instance_type")
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/adammck/venv"
+	"github.com/blang/vfs"
+)
+
+// consulWorkspaceSeparator separates the path of the state and the workspace in
+// the keys of the states of workspaces other than the default one.
+const consulWorkspaceSeparator = "-env:"
+
+// consulBackend reads states from Consul KV, stored like Terraform's `consul`
+// backend does: optionally gzip-compressed, and optionally split into chunks.
+// It's given as `consul://<host:port>/<path>`, with the optional parameters
+// `scheme` and `datacenter`. The address and the token default to
+// CONSUL_HTTP_ADDR and CONSUL_HTTP_TOKEN.
+type consulBackend struct {
+	address    *url.URL
+	path       string
+	datacenter string
+	token      string
+	username   string
+	password   string
+}
+
+func newConsulBackend(u *url.URL, fs vfs.Filesystem, env venv.Env) (backend, error) {
+	params := u.Query()
+
+	b := &consulBackend{
+		path:       strings.Trim(u.Path, "/"),
+		datacenter: params.Get("datacenter"),
+		token:      env.Getenv("CONSUL_HTTP_TOKEN"),
+	}
+	if b.path == "" {
+		return nil, fmt.Errorf("Invalid Consul URL %s, expected consul://<host:port>/<path>", backendSource(u))
+	}
+
+	host := u.Host
+	if host == "" {
+		host = env.Getenv("CONSUL_HTTP_ADDR")
+	}
+	if host == "" {
+		host = "127.0.0.1:8500"
+	}
+
+	// CONSUL_HTTP_ADDR may contain the scheme
+	scheme := params.Get("scheme")
+	if i := strings.Index(host, "://"); i >= 0 {
+		if scheme == "" {
+			scheme = host[:i]
+		}
+		host = host[i+3:]
+	}
+	if scheme == "" {
+		scheme = "http"
+	}
+	b.address = &url.URL{Scheme: scheme, Host: host}
+
+	auth := env.Getenv("CONSUL_HTTP_AUTH")
+	if u.User != nil {
+		password, _ := u.User.Password()
+		auth = u.User.Username() + ":" + password
+	}
+	if auth != "" {
+		parts := strings.SplitN(auth, ":", 2)
+		b.username = parts[0]
+		if len(parts) == 2 {
+			b.password = parts[1]
+		}
+	}
+
+	return b, nil
+}
+
+// key returns the key of the state of the given workspace.
+func (b *consulBackend) key(workspace string) string {
+	if workspace == "" || workspace == "default" {
+		return b.path
+	}
+	return b.path + consulWorkspaceSeparator + workspace
+}
+
+// get returns the value of the given key, using the given query parameters, or
+// nil if it doesn't exist.
+func (b *consulBackend) get(key string, query url.Values) ([]byte, error) {
+	u := *b.address
+	u.Path = "/v1/kv/" + key
+	if b.datacenter != "" {
+		query.Set("dc", b.datacenter)
+	}
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if b.token != "" {
+		req.Header.Set("X-Consul-Token", b.token)
+	}
+	if b.username != "" || b.password != "" {
+		req.SetBasicAuth(b.username, b.password)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return body, nil
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("GET consul://%s/%s returned %s: %s", b.address.Host, key, resp.Status, strings.TrimSpace(string(body)))
+	}
+}
+
+func (b *consulBackend) state(workspace string) (io.Reader, error) {
+	key := b.key(workspace)
+
+	value, err := b.get(key, url.Values{"raw": {""}})
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		return nil, fmt.Errorf("No state at consul://%s/%s", b.address.Host, key)
+	}
+
+	// Large states are split into chunks, and the key holds their keys instead
+	var chunked struct {
+		Hash   *string  `json:"current-hash"`
+		Chunks []string `json:"chunks"`
+	}
+	hash := ""
+	if err := json.Unmarshal(value, &chunked); err == nil && chunked.Hash != nil {
+		hash = *chunked.Hash
+
+		value = nil
+		for _, chunk := range chunked.Chunks {
+			part, err := b.get(chunk, url.Values{"raw": {""}})
+			if err != nil {
+				return nil, err
+			}
+			if part == nil {
+				return nil, fmt.Errorf("Chunk %s of the state at consul://%s/%s could not be found", chunk, b.address.Host, key)
+			}
+			value = append(value, part...)
+		}
+	}
+
+	// Compressed states start with the gzip magic number instead of JSON
+	if len(value) > 0 && value[0] == 0x1f {
+		r, err := gzip.NewReader(bytes.NewReader(value))
+		if err != nil {
+			return nil, fmt.Errorf("Error decompressing the state at consul://%s/%s: %s", b.address.Host, key, err)
+		}
+		value, err = ioutil.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("Error decompressing the state at consul://%s/%s: %s", b.address.Host, key, err)
+		}
+	}
+
+	if hash != "" && fmt.Sprintf("%x", md5.Sum(value)) != hash {
+		return nil, fmt.Errorf("The state at consul://%s/%s does not match the expected hash", b.address.Host, key)
+	}
+
+	return bytes.NewReader(value), nil
+}
+
+// workspaces lists the default workspace and the workspaces which have a key
+// next to the path, like Terraform does.
+func (b *consulBackend) workspaces() ([]string, error) {
+	prefix := b.path + consulWorkspaceSeparator
+
+	body, err := b.get(prefix, url.Values{"keys": {""}, "separator": {"/"}})
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	if body != nil {
+		err = json.Unmarshal(body, &keys)
+		if err != nil {
+			return nil, fmt.Errorf("Error listing consul://%s/%s: %s", b.address.Host, prefix, err)
+		}
+	}
+
+	// Keys with a slash are locks or chunks, not states
+	var workspaces []string
+	for _, key := range keys {
+		name := strings.TrimPrefix(key, prefix)
+		if strings.HasPrefix(key, prefix) && name != "" && !strings.Contains(name, "/") {
+			workspaces = append(workspaces, name)
+		}
+	}
+	sort.Strings(workspaces)
+
+	return append([]string{"default"}, workspaces...), nil
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// Encryption holds the settings for decrypting states encrypted with OpenTofu
+// state encryption. Only the `pbkdf2` key provider with the `aes_gcm` method is
+// supported.
+type Encryption struct {
+
+	// Passphrase of the `pbkdf2` key provider.
+	Passphrase string `yaml:"passphrase"`
+
+	// Additional authenticated data of the `aes_gcm` method, if configured.
+	AAD string `yaml:"aad"`
+}
+
+// encryptedState is a state (or plan) encrypted with OpenTofu state encryption.
+type encryptedState struct {
+	Meta    map[string][]byte `json:"meta"` // by key provider, e.g. `key_provider.pbkdf2.mykey`
+	Data    []byte            `json:"encrypted_data"`
+	Version string            `json:"encryption_version"`
+}
+
+// pbkdf2Metadata is the metadata of the `pbkdf2` key provider, which is stored
+// with the encrypted state.
+type pbkdf2Metadata struct {
+	Salt         []byte `json:"salt"`
+	Iterations   int    `json:"iterations"`
+	HashFunction string `json:"hash_function"`
+	KeyLength    int    `json:"key_length"`
+}
+
+// decodeState decompresses (gzip or zstd, detected by their magic bytes) and
+// decrypts the given state with the given settings until it's plain JSON. Plain
+// states are returned unchanged.
+func decodeState(b []byte, enc *Encryption) ([]byte, error) {
+	// Archives of encrypted states may be compressed, so several rounds may be
+	// needed. They are limited, so that nested archives can't keep it busy.
+	for i := 0; i < 4; i++ {
+		var err error
+
+		switch {
+		case bytes.HasPrefix(b, gzipMagic):
+			var r *gzip.Reader
+			r, err = gzip.NewReader(bytes.NewReader(b))
+			if err == nil {
+				b, err = ioutil.ReadAll(r)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("gzip: %s", err)
+			}
+
+		case bytes.HasPrefix(b, zstdMagic):
+			var d *zstd.Decoder
+			d, err = zstd.NewReader(nil)
+			if err == nil {
+				b, err = d.DecodeAll(b, nil)
+				d.Close()
+			}
+			if err != nil {
+				return nil, fmt.Errorf("zstd: %s", err)
+			}
+
+		default:
+			var encrypted encryptedState
+			if json.Unmarshal(b, &encrypted) != nil || encrypted.Version == "" || encrypted.Data == nil {
+				return b, nil
+			}
+
+			b, err = enc.decrypt(&encrypted)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return b, nil
+}
+
+// decrypt decrypts a state encrypted with the `pbkdf2` key provider and the
+// `aes_gcm` method. Every `pbkdf2` key provider stored with the state is tried,
+// as OpenTofu stores the fallback key providers, too.
+func (e *Encryption) decrypt(enc *encryptedState) ([]byte, error) {
+	if enc.Version != "v0" {
+		return nil, fmt.Errorf("unsupported OpenTofu encryption version %q", enc.Version)
+	}
+	if e.Passphrase == "" {
+		return nil, fmt.Errorf("the state is encrypted with OpenTofu state encryption, but no passphrase is set (TF_INVENTORY_ENCRYPTION_PASSPHRASE)")
+	}
+
+	var names []string
+	for name := range enc.Meta {
+		if strings.HasPrefix(name, "key_provider.pbkdf2.") {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("the state is encrypted with an unsupported OpenTofu key provider, only pbkdf2 is supported")
+	}
+	sort.Strings(names)
+
+	var err error
+	for _, name := range names {
+		var meta pbkdf2Metadata
+		err = json.Unmarshal(enc.Meta[name], &meta)
+		if err != nil {
+			err = fmt.Errorf("invalid metadata of %s: %s", name, err)
+			continue
+		}
+
+		var key []byte
+		key, err = meta.key(e.Passphrase)
+		if err != nil {
+			err = fmt.Errorf("%s: %s", name, err)
+			continue
+		}
+
+		var plain []byte
+		plain, err = decryptAESGCM(key, enc.Data, []byte(e.AAD))
+		if err == nil {
+			return plain, nil
+		}
+		err = fmt.Errorf("decrypting with %s failed (wrong passphrase?): %s", name, err)
+	}
+
+	return nil, err
+}
+
+// key derives the key from the passphrase.
+func (m *pbkdf2Metadata) key(passphrase string) ([]byte, error) {
+	var h func() hash.Hash
+	switch m.HashFunction {
+	case "sha224":
+		h = sha256.New224
+	case "sha256":
+		h = sha256.New
+	case "sha384":
+		h = sha512.New384
+	case "sha512":
+		h = sha512.New
+	default:
+		return nil, fmt.Errorf("unsupported hash function %q", m.HashFunction)
+	}
+
+	if m.Iterations <= 0 || m.KeyLength <= 0 {
+		return nil, fmt.Errorf("invalid iterations (%d) or key length (%d)", m.Iterations, m.KeyLength)
+	}
+
+	return pbkdf2Key([]byte(passphrase), m.Salt, m.Iterations, m.KeyLength, h), nil
+}
+
+// decryptAESGCM decrypts data consisting of the nonce and the ciphertext, like
+// the `aes_gcm` method of OpenTofu writes it.
+func decryptAESGCM(key []byte, data []byte, aad []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("encrypted data too short")
+	}
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+
+	if len(aad) == 0 {
+		aad = nil
+	}
+	return gcm.Open(nil, nonce, ciphertext, aad)
+}
+
+// pbkdf2Key derives a key with PBKDF2 as defined in RFC 8018.
+func pbkdf2Key(password []byte, salt []byte, iterations int, keyLength int, h func() hash.Hash) []byte {
+	prf := hmac.New(h, password)
+	hashLength := prf.Size()
+	blocks := (keyLength + hashLength - 1) / hashLength
+
+	key := make([]byte, 0, blocks*hashLength)
+	u := make([]byte, hashLength)
+	for block := 1; block <= blocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		var index [4]byte
+		binary.BigEndian.PutUint32(index[:], uint32(block))
+		prf.Write(index[:])
+		u = prf.Sum(u[:0])
+
+		t := make([]byte, hashLength)
+		copy(t, u)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+
+	return key[:keyLength]
+}
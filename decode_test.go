@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPBKDF2Key(t *testing.T) {
+	// Test vectors of RFC 6070
+	assert.Equal(t, "0c60c80f961f0e71f3a9b524af6012062fe037a6", hex.EncodeToString(pbkdf2Key([]byte("password"), []byte("salt"), 1, 20, sha1.New)))
+	assert.Equal(t, "4b007901b765489abead49d926f721d065a429c1", hex.EncodeToString(pbkdf2Key([]byte("password"), []byte("salt"), 4096, 20, sha1.New)))
+	assert.Equal(t, "3d2eec4fe41c849b80c8d83662c0e44a8b291a964cf2f07038", hex.EncodeToString(pbkdf2Key([]byte("passwordPASSWORDpassword"), []byte("saltSALTsaltSALTsaltSALTsaltSALTsalt"), 4096, 25, sha1.New)))
+}
+
+func TestPBKDF2MetadataKey(t *testing.T) {
+	for name, h := range map[string]func() hash.Hash{
+		"sha224": sha256.New224,
+		"sha256": sha256.New,
+		"sha384": sha512.New384,
+		"sha512": sha512.New,
+	} {
+		meta := pbkdf2Metadata{Salt: []byte("salt"), Iterations: 10, HashFunction: name, KeyLength: 32}
+		key, err := meta.key("passphrase")
+		assert.NoError(t, err, name)
+		assert.Equal(t, pbkdf2Key([]byte("passphrase"), []byte("salt"), 10, 32, h), key, name)
+	}
+
+	_, err := (&pbkdf2Metadata{Salt: []byte("salt"), Iterations: 10, HashFunction: "md5", KeyLength: 32}).key("passphrase")
+	assert.EqualError(t, err, `unsupported hash function "md5"`)
+}
+
+// encryptTestState encrypts the state like OpenTofu does with a `pbkdf2` key
+// provider of the given name and the `aes_gcm` method.
+func encryptTestState(t *testing.T, state string, passphrase string, aad string, names ...string) []byte {
+	salt := []byte("0123456789abcdef0123456789abcdef")
+	meta := pbkdf2Metadata{Salt: salt, Iterations: 1000, HashFunction: "sha512", KeyLength: 32}
+	key := pbkdf2Key([]byte(passphrase), salt, meta.Iterations, meta.KeyLength, sha512.New)
+
+	block, err := aes.NewCipher(key)
+	assert.NoError(t, err)
+	gcm, err := cipher.NewGCM(block)
+	assert.NoError(t, err)
+	nonce := []byte("0123456789ab")
+	var additional []byte
+	if aad != "" {
+		additional = []byte(aad)
+	}
+
+	enc := encryptedState{
+		Meta:    map[string][]byte{},
+		Data:    append(nonce, gcm.Seal(nil, nonce, []byte(state), additional)...),
+		Version: "v0",
+	}
+	for _, name := range names {
+		enc.Meta[name], err = json.Marshal(meta)
+		assert.NoError(t, err)
+	}
+
+	b, err := json.Marshal(enc)
+	assert.NoError(t, err)
+	return b
+}
+
+func gzipBytes(t *testing.T, b []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write(b)
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func zstdBytes(t *testing.T, b []byte) []byte {
+	e, err := zstd.NewWriter(nil)
+	assert.NoError(t, err)
+	defer e.Close()
+	return e.EncodeAll(b, nil)
+}
+
+func TestReadCompressedState(t *testing.T) {
+	for name, b := range map[string][]byte{
+		"gzip":      gzipBytes(t, []byte(exampleStateFileTerraformV4)),
+		"zstd":      zstdBytes(t, []byte(exampleStateFileTerraformV4)),
+		"zstd+gzip": zstdBytes(t, gzipBytes(t, []byte(exampleStateFileTerraformV4))),
+	} {
+		var s stateAnyTerraformVersion
+		err := s.read(bytes.NewReader(b), &Encryption{})
+		assert.NoError(t, err, name)
+		assert.Len(t, s.resources(), 5, name)
+	}
+
+	var s stateAnyTerraformVersion
+	err := s.read(bytes.NewReader(gzipBytes(t, []byte(exampleStateFileTerraformV4))[:20]), &Encryption{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "gzip")
+}
+
+func TestReadEncryptedState(t *testing.T) {
+	encrypted := encryptTestState(t, exampleStateFileTerraformV4, "correct horse battery staple", "", "key_provider.pbkdf2.mykey")
+
+	// Without or with a wrong passphrase
+	var s stateAnyTerraformVersion
+	enc := &Encryption{}
+	err := s.read(bytes.NewReader(encrypted), enc)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "TF_INVENTORY_ENCRYPTION_PASSPHRASE")
+
+	enc = &Encryption{Passphrase: "wrong"}
+	err = s.read(bytes.NewReader(encrypted), enc)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "key_provider.pbkdf2.mykey")
+
+	enc = &Encryption{Passphrase: "correct horse battery staple"}
+	for name, b := range map[string][]byte{
+		"plain": encrypted,
+		"gzip":  gzipBytes(t, encrypted),
+		"fallback": encryptTestState(t, exampleStateFileTerraformV4, "correct horse battery staple", "",
+			"key_provider.pbkdf2.new", "key_provider.pbkdf2.old"),
+	} {
+		s = stateAnyTerraformVersion{}
+		err = s.read(bytes.NewReader(b), enc)
+		assert.NoError(t, err, name)
+		assert.Len(t, s.resources(), 5, name)
+	}
+
+	// Additional authenticated data has to match
+	withAAD := encryptTestState(t, exampleStateFileTerraformV4, "correct horse battery staple", "prod", "key_provider.pbkdf2.mykey")
+	err = s.read(bytes.NewReader(withAAD), enc)
+	assert.Error(t, err)
+	enc = &Encryption{Passphrase: "correct horse battery staple", AAD: "prod"}
+	err = s.read(bytes.NewReader(withAAD), enc)
+	assert.NoError(t, err)
+
+	// Other key providers are not supported
+	other := encryptTestState(t, exampleStateFileTerraformV4, "correct horse battery staple", "", "key_provider.aws_kms.mykey")
+	err = s.read(bytes.NewReader(other), enc)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "only pbkdf2")
+
+	// Unencrypted states of OpenTofu are read as usual
+	s = stateAnyTerraformVersion{}
+	err = s.read(strings.NewReader(exampleStateFileOpenTofu), enc)
+	assert.NoError(t, err)
+}
@@ -5,5 +5,7 @@ go 1.16
 require (
 	github.com/adammck/venv v0.0.0-20160819025605-8a9c907a37d3
 	github.com/blang/vfs v1.0.0
+	github.com/klauspost/compress v1.15.9
 	github.com/stretchr/testify v1.4.0
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// GroupCollisions defines what happens if several groups get the same name.
+type GroupCollisions string
+
+const (
+	// GroupCollisionsMerge means that the hosts of the groups are merged into a
+	// single group, which is reported to stderr. This is the default.
+	GroupCollisionsMerge GroupCollisions = "merge"
+
+	// GroupCollisionsPrefix means that the group which was added first keeps
+	// the name, and the others are prefixed with their family, e.g. `tags_web`.
+	// Groups of the same family are merged.
+	GroupCollisionsPrefix GroupCollisions = "prefix"
+
+	// GroupCollisionsFail means that the inventory isn't written.
+	GroupCollisionsFail GroupCollisions = "fail"
+)
+
+// GroupNames holds how the names of the generated groups are built.
+type GroupNames struct {
+
+	// Whether to replace the characters which Ansible doesn't allow in group
+	// names, i.e. anything but letters, digits and underscores, and a leading
+	// digit. This is what Ansible does with `force_valid_group_names = always`.
+	Sanitize bool `yaml:"sanitize"`
+
+	// Replacement of the invalid characters, by default `_`.
+	Replacement string `yaml:"replacement"`
+
+	// What to do if groups get the same name, by default `merge`.
+	Collisions GroupCollisions `yaml:"collisions"`
+}
+
+func (g GroupNames) collisions() GroupCollisions {
+	if g.Collisions == "" {
+		return GroupCollisionsMerge
+	}
+	return g.Collisions
+}
+
+// sanitize returns the given group name with the invalid characters replaced,
+// if sanitizing is enabled.
+func (g GroupNames) sanitize(name string) string {
+	if !g.Sanitize {
+		return name
+	}
+
+	replacement := g.Replacement
+	if replacement == "" {
+		replacement = "_"
+	}
+
+	var b strings.Builder
+	for i, c := range name {
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || (i > 0 && c >= '0' && c <= '9') {
+			b.WriteRune(c)
+		} else {
+			b.WriteString(replacement)
+		}
+	}
+	return b.String()
+}
+
+// groupNamer adds the groups of a state to its output. It sanitizes the names
+// of the generated groups, resolves collisions as configured, and keeps track
+// of the names the groups ended up with.
+type groupNamer struct {
+	conf   *Config
+	output map[string]interface{}
+	stderr io.Writer
+
+	// the family of every group of the output
+	owners map[string]string
+
+	// the output names of the groups by family and generated name
+	names map[string]map[string]string
+
+	// the family of every parent group added by addParent
+	parents map[string]string
+
+	// the names of the output which aren't valid in Ansible
+	invalid []string
+}
+
+func newGroupNamer(conf *Config, output map[string]interface{}, stderr io.Writer) *groupNamer {
+	n := &groupNamer{
+		conf:    conf,
+		output:  output,
+		stderr:  stderr,
+		owners:  make(map[string]string),
+		names:   make(map[string]map[string]string),
+		parents: make(map[string]string),
+	}
+	for name := range output {
+		n.owners[name] = "reserved"
+	}
+	return n
+}
+
+// add adds the groups of the given family, unless the family is disabled. The
+// names of the groups from the config file (family `custom`) are kept as they
+// are.
+func (n *groupNamer) add(family string, groups map[string][]string) error {
+	if !n.conf.groupEnabled(family) {
+		return nil
+	}
+
+	keys := []string{}
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, generated := range keys {
+		name := generated
+		if family != "custom" {
+			name = n.conf.GroupNames.sanitize(generated)
+		}
+		if owner, exists := n.owners[name]; exists && owner != family {
+			switch n.conf.GroupNames.collisions() {
+			case GroupCollisionsPrefix:
+				name = fmt.Sprintf("%s_%s", family, name)
+			case GroupCollisionsMerge:
+				// groups aren't merged into parents, see addParent
+				if n.parents[name] != "" {
+					fmt.Fprintf(n.stderr, "adding %s group %s as %s_%s, the name %s is taken by the parent group of the %s groups\n", family, generated, family, name, name, owner)
+					name = fmt.Sprintf("%s_%s", family, name)
+				}
+			}
+		}
+
+		n.checkName(name)
+		err := n.addGroup(family, generated, name, groups[generated])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (n *groupNamer) addGroup(family string, generated string, name string, hosts []string) error {
+	old, exists := n.output[name]
+	if !exists {
+		n.output[name] = append([]string{}, hosts...)
+		n.owners[name] = family
+		n.setName(family, generated, name)
+		return nil
+	}
+
+	// e.g. the individual group of a resource whose hostname is taken by
+	// another resource already
+	list, isList := old.([]string)
+	if isList && n.owners[name] == family && n.names[family][generated] == name && containsAll(list, hosts) {
+		return nil
+	}
+
+	owner := n.owners[name]
+	if n.conf.GroupNames.collisions() == GroupCollisionsFail || (n.conf.GroupNames.collisions() == GroupCollisionsPrefix && owner != family) {
+		return fmt.Errorf("%s group %s collides with the %s group %s", family, generated, owner, name)
+	}
+
+	if parent, isParent := old.(*parentGroup); isParent {
+		// e.g. an ordered group with the individual groups as children
+		fmt.Fprintf(n.stderr, "merging %s group %s %v into the %s group %s %v\n", family, generated, hosts, owner, name, parent.Hosts)
+		for _, host := range hosts {
+			parent.Hosts = appendUniq(parent.Hosts, host)
+		}
+		sort.Strings(parent.Hosts)
+		n.setName(family, generated, name)
+		return nil
+	}
+	if !isList {
+		fmt.Fprintf(n.stderr, "not adding %s group %s, the output key %s is reserved\n", family, generated, name)
+		return nil
+	}
+	fmt.Fprintf(n.stderr, "merging %s group %s %v into the %s group %s %v\n", family, generated, hosts, owner, name, list)
+	for _, host := range hosts {
+		list = appendUniq(list, host)
+	}
+	sort.Strings(list)
+	n.output[name] = list
+	n.setName(family, generated, name)
+
+	return nil
+}
+
+// checkName remembers a group name which isn't valid in Ansible, see
+// reportInvalid.
+func (n *groupNamer) checkName(name string) {
+	if (GroupNames{Sanitize: true}).sanitize(name) != name && !contains(n.invalid, name) {
+		n.invalid = append(n.invalid, name)
+	}
+}
+
+// reportInvalid reports the group names which aren't valid in Ansible to
+// stderr. Ansible warns about them, or replaces their invalid characters with
+// `force_valid_group_names`, which breaks references to the original names.
+func (n *groupNamer) reportInvalid() {
+	if len(n.invalid) == 0 {
+		return
+	}
+	sort.Strings(n.invalid)
+	fmt.Fprintf(n.stderr, "%d group names aren't valid in Ansible, e.g. %s, see group_names.sanitize\n", len(n.invalid), n.invalid[0])
+}
+
+// containsAll returns whether all items are in strs.
+func containsAll(strs []string, items []string) bool {
+	for _, item := range items {
+		if !contains(strs, item) {
+			return false
+		}
+	}
+	return true
+}
+
+func (n *groupNamer) setName(family string, generated string, name string) {
+	if n.names[family] == nil {
+		n.names[family] = make(map[string]string)
+	}
+	n.names[family][generated] = name
+}
+
+// addParent adds a parent group of the given family with the given children,
+// e.g. the tag key `role` of the tag groups `role_web` and `role_db`. Parents
+// aren't merged into other groups of the same name, as that would change the
+// meaning of those groups. With the `fail` collision policy, this is an error;
+// otherwise they are prefixed with their family, e.g. `tags_role`, which is
+// reported to stderr with the `merge` policy.
+func (n *groupNamer) addParent(family string, generated string, children []string) error {
+	name := n.conf.GroupNames.sanitize(generated)
+	if owner, exists := n.owners[name]; exists && n.parents[name] != family {
+		if n.conf.GroupNames.collisions() == GroupCollisionsFail {
+			return fmt.Errorf("parent group %s of the %s groups %v collides with the %s group %s", generated, family, children, owner, name)
+		}
+
+		prefixed := fmt.Sprintf("%s_%s", family, name)
+		if _, exists := n.owners[prefixed]; exists && n.parents[prefixed] != family {
+			return fmt.Errorf("parent group %s of the %s groups %v collides with the groups %s and %s", generated, family, children, name, prefixed)
+		}
+		if n.conf.GroupNames.collisions() == GroupCollisionsMerge {
+			fmt.Fprintf(n.stderr, "adding parent group %s of the %s groups %v as %s, the name %s is taken by the %s group\n", generated, family, children, prefixed, name, owner)
+		}
+		name = prefixed
+	}
+
+	n.checkName(name)
+	addChildren(n.output, name, children, n.stderr)
+	n.owners[name] = family
+	n.parents[name] = family
+
+	return nil
+}
+
+// name returns the output name of the given generated group, and whether the
+// group was added.
+func (n *groupNamer) name(family string, generated string) (string, bool) {
+	name, exists := n.names[family][generated]
+	return name, exists
+}
+
+// merge merges the groups gathered from another state into the output. Groups
+// of the same family and name are merged like the groups of a single state,
+// except for individual groups of different hosts. Other collisions are
+// handled by the collision policy, and parents aren't merged into groups of
+// other families.
+func (n *groupNamer) merge(other *groupNamer, source string) error {
+	keys := []string{}
+	for k := range other.output {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	// rename the groups first, so that the children of the parents are renamed
+	// before they are merged
+	collisions := n.conf.GroupNames.collisions()
+	for _, k := range keys {
+		owner, exists := n.owners[k]
+		if !exists || !n.collides(other, k) {
+			continue
+		}
+
+		family := other.owners[k]
+		if collisions == GroupCollisionsFail {
+			return fmt.Errorf("%s group %s collides with the %s group %s of another state", family, k, owner, k)
+		}
+		if owner == family || (collisions == GroupCollisionsMerge && n.parents[k] == "" && other.parents[k] == "") {
+			fmt.Fprintf(n.stderr, "state %s merging %s group %s %v into the %s group %s %v\n", source, family, k, other.output[k], owner, k, n.output[k])
+			continue
+		}
+
+		prefixed := fmt.Sprintf("%s_%s", family, k)
+		_, taken := other.output[prefixed]
+		if o, exists := n.owners[prefixed]; taken || (exists && o != family) {
+			return fmt.Errorf("%s group %s collides with the %s group %s of another state, and %s is taken", family, k, owner, k, prefixed)
+		}
+		if collisions == GroupCollisionsMerge {
+			fmt.Fprintf(n.stderr, "state %s adding %s group %s as %s, the name %s is taken by the %s group\n", source, family, k, prefixed, k, owner)
+		}
+		other.rename(k, prefixed)
+	}
+
+	keys = keys[:0]
+	for k := range other.output {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		mergeGroup(n.output, k, other.output[k], source, n.stderr)
+		if _, exists := n.owners[k]; !exists {
+			n.owners[k] = other.owners[k]
+		}
+		if family := other.parents[k]; family != "" && n.parents[k] == "" {
+			n.parents[k] = family
+		}
+	}
+
+	return nil
+}
+
+// collides returns whether the group of the given name of another state
+// collides with the group of the same name of the output, i.e. whether they
+// belong to different families, or are individual groups of different hosts.
+func (n *groupNamer) collides(other *groupNamer, name string) bool {
+	if n.owners[name] != other.owners[name] {
+		return true
+	}
+	if other.owners[name] != "individual" {
+		return false
+	}
+
+	old, isList := n.output[name].([]string)
+	hosts, _ := other.output[name].([]string)
+	return !isList || !containsAll(old, hosts)
+}
+
+// rename renames a group, and replaces it in the children of the parents.
+func (n *groupNamer) rename(old string, name string) {
+	n.output[name] = n.output[old]
+	n.owners[name] = n.owners[old]
+	delete(n.output, old)
+	delete(n.owners, old)
+	if family, exists := n.parents[old]; exists {
+		n.parents[name] = family
+		delete(n.parents, old)
+	}
+
+	for _, grp := range n.output {
+		if parent, isParent := grp.(*parentGroup); isParent && contains(parent.Children, old) {
+			children := []string{name}
+			for _, child := range parent.Children {
+				if child != old {
+					children = append(children, child)
+				}
+			}
+			sort.Strings(children)
+			parent.Children = children
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const exampleStateFileGroupNames = `
+{
+	"version": 4,
+	"terraform_version": "1.5.7",
+	"resources": [
+		{
+			"mode": "managed",
+			"type": "aws_instance",
+			"name": "web",
+			"instances": [
+				{
+					"index_key": 0,
+					"attributes": {
+						"id": "i-0",
+						"private_ip": "10.0.0.1",
+						"availability_zone": "us-east-1a",
+						"tags": {
+							"web": "",
+							"kubernetes.io/role": "master"
+						}
+					}
+				}
+			]
+		},
+		{
+			"mode": "managed",
+			"type": "aws_instance",
+			"name": "db",
+			"instances": [
+				{
+					"attributes": {
+						"id": "i-1",
+						"private_ip": "10.0.0.2",
+						"tags": {
+							"web": ""
+						}
+					}
+				}
+			]
+		}
+	]
+}
+`
+
+func TestSanitizeGroupName(t *testing.T) {
+	assert.Equal(t, "kubernetes.io/role_master", GroupNames{}.sanitize("kubernetes.io/role_master"))
+	assert.Equal(t, "kubernetes_io_role_master", GroupNames{Sanitize: true}.sanitize("kubernetes.io/role_master"))
+	assert.Equal(t, "_a_b_c", GroupNames{Sanitize: true}.sanitize("1a b:c"))
+	assert.Equal(t, "role_web_server", GroupNames{Sanitize: true}.sanitize("role_web-server"))
+	assert.Equal(t, "env_xprodx", GroupNames{Sanitize: true, Replacement: "x"}.sanitize("env_(prod)"))
+}
+
+func TestGroupNamesSanitize(t *testing.T) {
+	s := readTestState(t, exampleStateFileGroupNames, "names.tfstate", "")
+
+	var stderr bytes.Buffer
+	groups := gatherTestGroups(t, s, &Config{GroupNames: GroupNames{Sanitize: true}}, &stderr)
+	assert.NotContains(t, stderr.String(), "valid in Ansible")
+	assert.Equal(t, []string{"10.0.0.1"}, groups["kubernetes_io_role_master"])
+	assert.Equal(t, &parentGroup{Children: []string{"kubernetes_io_role_master"}}, groups["kubernetes_io_role"])
+	assert.Equal(t, []string{"10.0.0.1"}, groups["availability_zone_us_east_1a"])
+	assert.Equal(t, &parentGroup{Children: []string{"availability_zone_us_east_1a"}}, groups["availability_zone"])
+	assert.NotContains(t, groups, "kubernetes.io/role_master")
+	assert.NotContains(t, groups, "availability_zone_us-east-1a")
+}
+
+func TestGroupNamesCollisions(t *testing.T) {
+	s := readTestState(t, exampleStateFileGroupNames, "names.tfstate", "")
+
+	// the valueless tag `web` and the ordered group `web` are merged by default
+	var stderr bytes.Buffer
+	groups := gatherTestGroups(t, s, &Config{}, &stderr)
+	assert.Equal(t, &parentGroup{Hosts: []string{"10.0.0.1", "10.0.0.2"}, Children: []string{"web_0"}}, groups["web"])
+	assert.Equal(t, "merging tags group web [10.0.0.1 10.0.0.2] into the ordered group web [10.0.0.1]\n2 group names aren't valid in Ansible, e.g. kubernetes.io/role, see group_names.sanitize\n", stderr.String())
+
+	stderr.Reset()
+	groups = gatherTestGroups(t, s, &Config{GroupNames: GroupNames{Collisions: GroupCollisionsPrefix}}, &stderr)
+	assert.Equal(t, "2 group names aren't valid in Ansible, e.g. kubernetes.io/role, see group_names.sanitize\n", stderr.String())
+	assert.Equal(t, &parentGroup{Hosts: []string{"10.0.0.1"}, Children: []string{"web_0"}}, groups["web"])
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, groups["tags_web"])
+
+	var stdout bytes.Buffer
+	stderr.Reset()
+	exitCode := cmdList(&stdout, &stderr, []*stateAnyTerraformVersion{s}, &Config{GroupNames: GroupNames{Collisions: GroupCollisionsFail}})
+	assert.Equal(t, 1, exitCode)
+	assert.Equal(t, "", stdout.String())
+	assert.Equal(t, "Error gathering inventory: state names.tfstate: tags group web collides with the ordered group web\n", stderr.String())
+}
+
+func TestGroupNamesReserved(t *testing.T) {
+	s := readTestState(t, exampleStateFileGroupNames, "names.tfstate", "")
+	conf := &Config{
+		Groups:     []GroupRule{{Name: "all", Type: "aws_instance"}},
+		GroupNames: GroupNames{Collisions: GroupCollisionsPrefix},
+	}
+
+	groups := gatherTestGroups(t, s, conf, &bytes.Buffer{})
+	assert.IsType(t, &allGroup{}, groups["all"])
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, groups["custom_all"])
+}
+
+func TestGroupNamesIndividualCollisions(t *testing.T) {
+	// aws_instance.web[0] and aws_instance.web (without count) are both `web_0`
+	s := readTestState(t, strings.Replace(exampleStateFileGroupNames, `"name": "db"`, `"name": "web"`, 1), "names.tfstate", "")
+
+	var stderr bytes.Buffer
+	groups := gatherTestGroups(t, s, &Config{DisableGroups: []string{"tags"}}, &stderr)
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, groups["web_0"])
+	assert.Equal(t, "merging individual group web_0 [10.0.0.2] into the individual group web_0 [10.0.0.1]\n", stderr.String())
+
+	_, err := gatherGroups(s, &Config{GroupNames: GroupNames{Collisions: GroupCollisionsFail}}, &bytes.Buffer{})
+	assert.EqualError(t, err, "individual group web_0 collides with the individual group web_0")
+}
+
+func TestGroupNamerMergeChildren(t *testing.T) {
+	var stderr bytes.Buffer
+	inventory := newGroupNamer(&Config{}, make(map[string]interface{}), &stderr)
+	assert.NoError(t, inventory.add("tags", map[string][]string{"role_web": {"10.0.0.1"}}))
+	assert.NoError(t, inventory.addParent("tags", "role", []string{"role_web"}))
+	assert.NoError(t, inventory.add("ordered", map[string][]string{"db": {"10.0.0.2"}}))
+
+	other := newGroupNamer(&Config{}, make(map[string]interface{}), &stderr)
+	assert.NoError(t, other.add("tags", map[string][]string{"role_db": {"10.0.0.2"}}))
+	assert.NoError(t, other.addParent("tags", "role", []string{"role_db"}))
+	assert.NoError(t, other.add("ordered", map[string][]string{"db": {"10.0.0.3"}}))
+	addChildren(other.output, "db", []string{"role_db"}, &stderr)
+
+	assert.NoError(t, inventory.merge(other, "other.tfstate"))
+	assert.Equal(t, "", stderr.String())
+	assert.Equal(t, &parentGroup{Children: []string{"role_db", "role_web"}}, inventory.output["role"])
+	assert.Equal(t, &parentGroup{Hosts: []string{"10.0.0.2", "10.0.0.3"}, Children: []string{"role_db"}}, inventory.output["db"])
+}
+
+func TestGroupNamesNotMergedIntoParents(t *testing.T) {
+	var stderr bytes.Buffer
+	n := newGroupNamer(&Config{}, make(map[string]interface{}), &stderr)
+	assert.NoError(t, n.add("tags", map[string][]string{"role_web": {"10.0.0.1"}}))
+	assert.NoError(t, n.addParent("tags", "role", []string{"role_web"}))
+	assert.NoError(t, n.add("state", map[string][]string{"role": {"10.0.0.1", "10.0.0.2"}}))
+
+	assert.Equal(t, &parentGroup{Children: []string{"role_web"}}, n.output["role"])
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, n.output["state_role"])
+	assert.Equal(t, "adding state group role as state_role, the name role is taken by the parent group of the tags groups\n", stderr.String())
+}
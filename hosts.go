@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+)
+
+// hostEntry is a host with the names it's known by.
+type hostEntry struct {
+	ip    net.IP
+	names []string
+}
+
+// hostEntries returns the addresses of the resources of the given states with
+// their names: the hostname (unless it's the address itself), the individual
+// group name (e.g. `web_0`), and for the first resource of an ordered group
+// also the name of that group (e.g. `web`). Names which are taken by several
+// hosts are reported to stderr, and the first host wins. Hosts whose address
+// isn't an IP address are reported to stderr and skipped.
+func hostEntries(states []*stateAnyTerraformVersion, stderr io.Writer) []*hostEntry {
+	var entries []*hostEntry
+	taken := make(map[string]bool)
+
+	for _, s := range states {
+		resources := s.resources()
+
+		// the first resource of each ordered group, by counter
+		first := make(map[string]*Resource)
+		for _, res := range resources {
+			if old, exists := first[res.baseName]; !exists || (counterSorter{[]*Resource{res, old}}).Less(0, 1) {
+				first[res.baseName] = res
+			}
+		}
+
+		for _, res := range resources {
+			ip := net.ParseIP(res.Address())
+			if ip == nil {
+				fmt.Fprintf(stderr, "state %s skipping host %s, its address %s is not an IP address\n", s.Source, res.Hostname(), res.Address())
+				continue
+			}
+
+			candidates := []string{res.Hostname(), res.individualName()}
+			if first[res.baseName] == res {
+				candidates = append(candidates, res.baseName)
+			}
+
+			entry := &hostEntry{ip: ip}
+			for _, name := range candidates {
+				if name == res.Address() || contains(entry.names, name) {
+					continue
+				}
+				if taken[name] {
+					fmt.Fprintf(stderr, "state %s not overwriting already existing host name %s with %s\n", s.Source, name, res.Address())
+					continue
+				}
+				taken[name] = true
+				entry.names = append(entry.names, name)
+			}
+			if len(entry.names) > 0 {
+				entries = append(entries, entry)
+			}
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].names[0] < entries[j].names[0]
+	})
+
+	return entries
+}
+
+// cmdHosts writes the hosts in the format of /etc/hosts.
+func cmdHosts(stdout io.Writer, stderr io.Writer, states []*stateAnyTerraformVersion) int {
+	var b strings.Builder
+	for _, entry := range hostEntries(states, stderr) {
+		b.WriteString(entry.ip.String() + "\t" + strings.Join(entry.names, " ") + "\n")
+	}
+
+	_, err := io.WriteString(stdout, b.String())
+	return checkErr(err, stderr)
+}
+
+// zoneTTL is the TTL of the records of the zone, in seconds.
+const zoneTTL = 3600
+
+// cmdZone writes the hosts as A and AAAA records of a DNS zone file fragment
+// for the given domain. Names are turned into valid hostnames, i.e. they are
+// lower-cased and underscores become hyphens. Hostnames which are fully
+// qualified are only written if they are within the domain. The records get the
+// default TTL of zoneTTL seconds.
+func cmdZone(stdout io.Writer, stderr io.Writer, states []*stateAnyTerraformVersion, domain string) int {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+
+	var b strings.Builder
+	b.WriteString("$ORIGIN " + domain + ".\n")
+	fmt.Fprintf(&b, "$TTL %d\n", zoneTTL)
+
+	written := make(map[string]bool)
+	for _, entry := range hostEntries(states, stderr) {
+		recordType := "AAAA"
+		if entry.ip.To4() != nil {
+			recordType = "A"
+		}
+
+		for _, name := range entry.names {
+			name = strings.ToLower(strings.Replace(strings.TrimSuffix(name, "."), "_", "-", -1))
+			if strings.HasSuffix(name, "."+domain) {
+				name = strings.TrimSuffix(name, "."+domain)
+			} else if strings.Contains(name, ".") {
+				continue
+			}
+			if !validHostnameLabels(name) || written[name] {
+				continue
+			}
+			written[name] = true
+
+			fmt.Fprintf(&b, "%s\tIN\t%s\t%s\n", name, recordType, entry.ip.String())
+		}
+	}
+
+	_, err := io.WriteString(stdout, b.String())
+	return checkErr(err, stderr)
+}
+
+// validHostnameLabels returns whether the (relative) name consists of valid
+// hostname labels: letters, digits and hyphens, not starting or ending with a
+// hyphen.
+func validHostnameLabels(name string) bool {
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
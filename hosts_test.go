@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const exampleStateFileHosts = `
+{
+	"version": 4,
+	"terraform_version": "1.5.7",
+	"resources": [
+		{
+			"mode": "managed",
+			"type": "aws_instance",
+			"name": "web",
+			"instances": [
+				{
+					"index_key": 0,
+					"attributes": {
+						"id": "i-0",
+						"name": "web-a.example.com",
+						"private_ip": "10.0.0.10"
+					}
+				},
+				{
+					"index_key": 1,
+					"attributes": {
+						"id": "i-1",
+						"name": "Web_B",
+						"private_ip": "10.0.0.11"
+					}
+				}
+			]
+		},
+		{
+			"mode": "managed",
+			"type": "scaleway_server",
+			"name": "v6",
+			"instances": [
+				{
+					"attributes": {
+						"id": "s-0",
+						"name": "v6.example.org",
+						"public_ipv6": "2001:db8::1"
+					}
+				}
+			]
+		},
+		{
+			"mode": "managed",
+			"type": "aws_instance",
+			"name": "db",
+			"instances": [
+				{
+					"attributes": {
+						"id": "i-2",
+						"private_ip": "db.internal"
+					}
+				}
+			]
+		}
+	]
+}
+`
+
+func TestHostsCommand(t *testing.T) {
+	os.Setenv("TF_HOSTNAME_KEY_NAME", "name")
+	defer os.Unsetenv("TF_HOSTNAME_KEY_NAME")
+	s := readTestState(t, exampleStateFileHosts, "hosts.tfstate", "")
+
+	var stdout, stderr bytes.Buffer
+	exitCode := cmdHosts(&stdout, &stderr, []*stateAnyTerraformVersion{s})
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, "state hosts.tfstate skipping host db.internal, its address db.internal is not an IP address\n", stderr.String())
+	assert.Equal(t, `10.0.0.11	Web_B web_1
+2001:db8::1	v6.example.org v6_0 v6
+10.0.0.10	web-a.example.com web_0 web
+`, stdout.String())
+}
+
+func TestHostsCommandCollisions(t *testing.T) {
+	s := readTestState(t, exampleStateFileHosts, "hosts.tfstate", "")
+
+	var single, stdout, stderr bytes.Buffer
+	cmdHosts(&single, &stderr, []*stateAnyTerraformVersion{s})
+	stderr.Reset()
+	exitCode := cmdHosts(&stdout, &stderr, []*stateAnyTerraformVersion{s, s})
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, single.String(), stdout.String())
+	assert.Contains(t, stderr.String(), "state hosts.tfstate not overwriting already existing host name web_0 with 10.0.0.10\n")
+}
+
+func TestZoneCommand(t *testing.T) {
+	os.Setenv("TF_HOSTNAME_KEY_NAME", "name")
+	defer os.Unsetenv("TF_HOSTNAME_KEY_NAME")
+	s := readTestState(t, exampleStateFileHosts, "hosts.tfstate", "")
+
+	var stdout, stderr bytes.Buffer
+	exitCode := cmdZone(&stdout, &stderr, []*stateAnyTerraformVersion{s}, "Example.com.")
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, `$ORIGIN example.com.
+$TTL 3600
+web-b	IN	A	10.0.0.11
+web-1	IN	A	10.0.0.11
+v6-0	IN	AAAA	2001:db8::1
+v6	IN	AAAA	2001:db8::1
+web-a	IN	A	10.0.0.10
+web-0	IN	A	10.0.0.10
+web	IN	A	10.0.0.10
+`, stdout.String())
+}
+
+func TestValidHostnameLabels(t *testing.T) {
+	assert.True(t, validHostnameLabels("web-0"))
+	assert.True(t, validHostnameLabels("web.eu"))
+	assert.False(t, validHostnameLabels("web_0"))
+	assert.False(t, validHostnameLabels("-web"))
+	assert.False(t, validHostnameLabels("web..eu"))
+	assert.False(t, validHostnameLabels(""))
+}
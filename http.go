@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/adammck/venv"
+	"github.com/blang/vfs"
+)
+
+// httpBackend reads the state from the address of a Terraform `http` backend,
+// e.g. a GitLab-managed state. It only sends GET requests, so it neither needs
+// nor takes the lock.
+type httpBackend struct {
+	address  *url.URL
+	username string
+	password string
+	token    string
+}
+
+func newHTTPBackend(u *url.URL, fs vfs.Filesystem, env venv.Env) (backend, error) {
+	b := &httpBackend{
+		username: env.Getenv("TF_HTTP_USERNAME"),
+		password: env.Getenv("TF_HTTP_PASSWORD"),
+		token:    env.Getenv("TF_INVENTORY_HTTP_TOKEN"),
+	}
+
+	// Credentials in the URL take precedence over the environment
+	address := *u
+	if address.User != nil {
+		b.username = address.User.Username()
+		b.password, _ = address.User.Password()
+		address.User = nil
+	}
+	b.address = &address
+
+	return b, nil
+}
+
+func (b *httpBackend) state(workspace string) (io.Reader, error) {
+	if workspace != "" && workspace != "default" {
+		return nil, fmt.Errorf("The http backend %s only has the default workspace", backendSource(b.address))
+	}
+
+	req, err := http.NewRequest("GET", b.address.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if b.token != "" {
+		req.Header.Set("Authorization", "Bearer "+b.token)
+	} else if b.username != "" || b.password != "" {
+		req.SetBasicAuth(b.username, b.password)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNoContent, http.StatusNotFound:
+		return nil, fmt.Errorf("No state at %s", backendSource(b.address))
+	default:
+		return nil, fmt.Errorf("GET %s returned %s", backendSource(b.address), resp.Status)
+	}
+
+	if len(body) == 0 {
+		return nil, fmt.Errorf("No state at %s", backendSource(b.address))
+	}
+
+	// Verify the checksum, if the server sends one, like Terraform does
+	if header := resp.Header.Get("Content-MD5"); header != "" {
+		sum := md5.Sum(body)
+		if header != base64.StdEncoding.EncodeToString(sum[:]) {
+			return nil, fmt.Errorf("Content-MD5 of the state at %s doesn't match", backendSource(b.address))
+		}
+	}
+
+	return bytes.NewReader(body), nil
+}
+
+// workspaces returns only the default workspace, as the http backend doesn't
+// support others.
+func (b *httpBackend) workspaces() ([]string, error) {
+	return []string{"default"}, nil
+}
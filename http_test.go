@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/adammck/venv"
+	"github.com/blang/vfs/memfs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPBackend(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "GET", r.Method)
+
+		user, password, ok := r.BasicAuth()
+		bearer := r.Header.Get("Authorization") == "Bearer glpat-token"
+		if !bearer && (!ok || user != "gitlab-ci-token" || password != "secret") {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/state/prod":
+			sum := md5.Sum([]byte(exampleStateFileTerraformV4))
+			w.Header().Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+			fmt.Fprint(w, exampleStateFileTerraformV4)
+		case "/state/corrupt":
+			w.Header().Set("Content-MD5", "AAAAAAAAAAAAAAAAAAAAAA==")
+			fmt.Fprint(w, exampleStateFileTerraformV4)
+		case "/state/new":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	env := venv.Mock()
+	env.Setenv("TF_HTTP_USERNAME", "gitlab-ci-token")
+	env.Setenv("TF_HTTP_PASSWORD", "secret")
+
+	states, err := readStates(memfs.Create(), env, &Terraform{}, &Encryption{}, server.URL+"/state/prod", "")
+	assert.NoError(t, err)
+	assert.Len(t, states, 1)
+	assert.Equal(t, server.URL+"/state/prod", states[0].Source)
+	assert.Len(t, states[0].resources(), 5)
+
+	// The http backend has only the default workspace
+	states, err = readStates(memfs.Create(), env, &Terraform{}, &Encryption{}, server.URL+"/state/prod", allWorkspaces)
+	assert.NoError(t, err)
+	assert.Len(t, states, 1)
+	assert.Equal(t, "default", states[0].Name)
+
+	_, err = readStates(memfs.Create(), env, &Terraform{}, &Encryption{}, server.URL+"/state/prod", "staging")
+	assert.Error(t, err)
+
+	// Credentials in the URL and bearer tokens
+	withUser := strings.Replace(server.URL, "http://", "http://gitlab-ci-token:secret@", 1)
+	_, err = readStates(memfs.Create(), venv.Mock(), &Terraform{}, &Encryption{}, withUser+"/state/prod", "")
+	assert.NoError(t, err)
+
+	withToken := venv.Mock()
+	withToken.Setenv("TF_INVENTORY_HTTP_TOKEN", "glpat-token")
+	_, err = readStates(memfs.Create(), withToken, &Terraform{}, &Encryption{}, server.URL+"/state/prod", "")
+	assert.NoError(t, err)
+
+	// Missing or corrupt states and wrong credentials are errors
+	for path, msg := range map[string]string{
+		"/state/new":     "No state",
+		"/state/missing": "No state",
+		"/state/corrupt": "Content-MD5",
+	} {
+		_, err = readStates(memfs.Create(), env, &Terraform{}, &Encryption{}, server.URL+path, "")
+		assert.Error(t, err, path)
+		assert.Contains(t, err.Error(), msg)
+	}
+
+	_, err = readStates(memfs.Create(), venv.Mock(), &Terraform{}, &Encryption{}, server.URL+"/state/prod", "")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "401")
+}
@@ -1,10 +1,17 @@
 package main
 
 import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
 	"github.com/adammck/venv"
 	"github.com/blang/vfs"
 )
 
+// GetInputPath returns the path of the state to read. TF_STATE and TI_TFSTATE
+// may contain several paths, separated like in PATH (e.g. `a:b`).
 func GetInputPath(fs vfs.Filesystem, env venv.Env) string {
 
 	var fn string
@@ -27,3 +34,115 @@ func GetInputPath(fs vfs.Filesystem, env venv.Env) string {
 
 	return "."
 }
+
+var (
+	urlSchemeSuffix = regexp.MustCompile(`(^|=)[a-zA-Z][a-zA-Z0-9+.-]*$`)
+	urlPortPrefix   = regexp.MustCompile(`^[0-9]+([/?]|$)`)
+)
+
+// SplitInputPath splits a list of input sources like filepath.SplitList, but
+// keeps URLs like `s3://bucket/key` or `http://host:8080/state` in one piece if
+// the list separator is a colon.
+func SplitInputPath(list string) []string {
+	if os.PathListSeparator != ':' {
+		return filepath.SplitList(list)
+	}
+	return splitInputPath(list)
+}
+
+func splitInputPath(list string) []string {
+	if list == "" {
+		return []string{}
+	}
+
+	pieces := strings.Split(list, ":")
+	var sources []string
+	for i := 0; i < len(pieces); i++ {
+		source := pieces[i]
+
+		if urlSchemeSuffix.MatchString(source) && i+1 < len(pieces) && strings.HasPrefix(pieces[i+1], "//") {
+			i++
+			source += ":" + pieces[i]
+
+			// A port directly follows the host, e.g. `//host` and `8080/state`
+			if !strings.Contains(pieces[i][2:], "/") && i+1 < len(pieces) && urlPortPrefix.MatchString(pieces[i+1]) {
+				i++
+				source += ":" + pieces[i]
+			}
+		}
+
+		sources = append(sources, source)
+	}
+
+	return sources
+}
+
+// ParseInputSource splits an input source of the form `name=path` into the name
+// and the path. Without a name, the input source is just the path.
+func ParseInputSource(source string) (string, string) {
+	i := strings.Index(source, "=")
+	if i <= 0 || strings.ContainsAny(source[:i], `/\`) {
+		return "", source
+	}
+
+	return source[:i], source[i+1:]
+}
+
+// GetWorkspace returns the Terraform workspace to read the state of Terraform
+// project directories from. An empty string is the selected workspace, `*` are
+// all workspaces.
+func GetWorkspace(env venv.Env) string {
+	return env.Getenv("TF_INVENTORY_WORKSPACE")
+}
+
+// GetTerraformBinary returns the binary to run for Terraform project
+// directories, if it's overridden in the environment.
+func GetTerraformBinary(env venv.Env) string {
+	return env.Getenv("TF_INVENTORY_BINARY")
+}
+
+// GetEncryptionPassphrase returns the passphrase for encrypted states, if it's
+// set in the environment.
+func GetEncryptionPassphrase(env venv.Env) string {
+	return env.Getenv("TF_INVENTORY_ENCRYPTION_PASSPHRASE")
+}
+
+// GetHostvarsFormat returns the format of the host vars, if it's set in the
+// environment.
+func GetHostvarsFormat(env venv.Env) HostvarsFormat {
+	return HostvarsFormat(env.Getenv("TF_HOSTVARS_FORMAT"))
+}
+
+// GetDomain returns the domain of the DNS zone output, if it's set in the
+// environment.
+func GetDomain(env venv.Env) string {
+	return env.Getenv("TF_INVENTORY_DOMAIN")
+}
+
+// GetConfigPath returns the path of the config file to use with the given state
+// path, or an empty string if there is none.
+func GetConfigPath(fs vfs.Filesystem, env venv.Env, statePath string) string {
+
+	fn := env.Getenv("TF_INVENTORY_CONFIG")
+	if fn != "" {
+		return fn
+	}
+
+	// Look next to the state file, or in the Terraform project directory. For
+	// remote backends, look in the current directory.
+	dir := statePath
+	f, err := fs.Stat(statePath)
+	if parseBackendURL(statePath) != nil {
+		dir = "."
+	} else if err != nil || !f.IsDir() {
+		dir = filepath.Dir(statePath)
+	}
+
+	fn = filepath.Join(dir, "terraform-inventory.yml")
+	_, err = fs.Stat(fn)
+	if err == nil {
+		return fn
+	}
+
+	return ""
+}
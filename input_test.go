@@ -21,6 +21,49 @@ func TestGetInputPath(t *testing.T) {
 	assert.Equal(t, "terraform", GetInputPath(fsWithDirs([]string{"terraform"}), envWith(map[string]string{"TF_STATE": "terraform"})))
 }
 
+func TestSplitInputPath(t *testing.T) {
+	assert.Equal(t, []string{}, splitInputPath(""))
+	assert.Equal(t, []string{"a.tfstate", "deploy/b"}, splitInputPath("a.tfstate:deploy/b"))
+	assert.Equal(t, []string{"s3://bucket/terraform.tfstate?region=eu-central-1", "prod=deploy/prod"}, splitInputPath("s3://bucket/terraform.tfstate?region=eu-central-1:prod=deploy/prod"))
+	assert.Equal(t, []string{"a", "staging=http://localhost:8080/state", "https://example.com:443", "b"}, splitInputPath("a:staging=http://localhost:8080/state:https://example.com:443:b"))
+	assert.Equal(t, []string{"s3://bucket/key", "8080/x"}, splitInputPath("s3://bucket/key:8080/x"))
+}
+
+func TestParseInputSource(t *testing.T) {
+	name, path := ParseInputSource("terraform.tfstate")
+	assert.Equal(t, "", name)
+	assert.Equal(t, "terraform.tfstate", path)
+
+	name, path = ParseInputSource("prod=deploy/prod")
+	assert.Equal(t, "prod", name)
+	assert.Equal(t, "deploy/prod", path)
+
+	name, path = ParseInputSource("deploy/a=b/terraform.tfstate")
+	assert.Equal(t, "", name)
+	assert.Equal(t, "deploy/a=b/terraform.tfstate", path)
+
+	name, path = ParseInputSource("s3://bucket/key?region=eu-central-1")
+	assert.Equal(t, "", name)
+	assert.Equal(t, "s3://bucket/key?region=eu-central-1", path)
+
+	name, path = ParseInputSource("prod=s3://bucket/key?region=eu-central-1")
+	assert.Equal(t, "prod", name)
+	assert.Equal(t, "s3://bucket/key?region=eu-central-1", path)
+
+	name, path = ParseInputSource("=terraform.tfstate")
+	assert.Equal(t, "", name)
+	assert.Equal(t, "=terraform.tfstate", path)
+}
+
+func TestGetConfigPath(t *testing.T) {
+	assert.Equal(t, "", GetConfigPath(memfs.Create(), venv.Mock(), "."))
+	assert.Equal(t, "aaa.yml", GetConfigPath(memfs.Create(), envWith(map[string]string{"TF_INVENTORY_CONFIG": "aaa.yml"}), "."))
+	assert.Equal(t, "deploy/terraform-inventory.yml", GetConfigPath(fsWithFiles([]string{"deploy/terraform.tfstate", "deploy/terraform-inventory.yml"}), venv.Mock(), "deploy/terraform.tfstate"))
+	assert.Equal(t, "terraform/terraform-inventory.yml", GetConfigPath(fsWithFiles([]string{"terraform/terraform-inventory.yml"}), venv.Mock(), "terraform"))
+	assert.Equal(t, "", GetConfigPath(fsWithFiles([]string{"terraform-inventory.yml", "terraform/terraform.tfstate"}), venv.Mock(), "terraform"))
+	assert.Equal(t, "terraform-inventory.yml", GetConfigPath(fsWithFiles([]string{"terraform-inventory.yml"}), venv.Mock(), "s3://bucket/terraform.tfstate"))
+}
+
 func envWith(env map[string]string) venv.Env {
 	e := venv.Mock()
 
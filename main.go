@@ -1,12 +1,12 @@
 package main
 
 import (
-	"bytes"
 	"flag"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strings"
 
 	"github.com/adammck/venv"
 	"github.com/blang/vfs"
@@ -16,10 +16,18 @@ var version = flag.Bool("version", false, "print version information and exit")
 var list = flag.Bool("list", false, "list mode")
 var host = flag.String("host", "", "host mode")
 var inventory = flag.Bool("inventory", false, "inventory mode")
+var format = flag.String("format", "", "output format of list and inventory mode: json, ini, yaml, ssh, hosts, zone or prometheus (default json for list, ini for inventory)")
+var domain = flag.String("domain", "", "domain of the zone format")
+var workspace = flag.String("workspace", "", "Terraform workspace to read, or * for all workspaces")
+
+// formats are the output formats of list and inventory mode.
+var formats = []string{"json", "ini", "yaml", "ssh", "hosts", "zone", "prometheus"}
+
+const usage = "Usage: %s [options] [name=]path...\npath: this is either a path to a state file, a folder from which `terraform commands` are valid, the URL of a remote backend, or - for stdin\nname: optional group name for all hosts of the path\n"
 
 func main() {
 	flag.Parse()
-	file := flag.Arg(0)
+	files := flag.Args()
 
 	if *version == true {
 		fmt.Printf("%s version %s\n", os.Args[0], versionInfo())
@@ -27,10 +35,12 @@ func main() {
 	}
 
 	fs := vfs.OS()
-	if file == "" {
-
-		env := venv.OS()
-		file = GetInputPath(fs, env)
+	env := venv.OS()
+	if len(files) == 0 {
+		files = SplitInputPath(GetInputPath(fs, env))
+	}
+	if *workspace == "" {
+		*workspace = GetWorkspace(env)
 	}
 
 	if !*list && *host == "" && !*inventory {
@@ -38,82 +48,260 @@ func main() {
 		os.Exit(1)
 	}
 
-	path, err := filepath.Abs(file)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Invalid file: %s\n", err)
+	if *format == "" && *list {
+		*format = "json"
+	} else if *format == "" {
+		*format = "ini"
+	}
+	if !contains(formats, *format) {
+		fmt.Fprintf(os.Stderr, "Unknown format %s, expected one of %s\n", *format, strings.Join(formats, ", "))
 		os.Exit(1)
 	}
-
-	f, err := fs.Stat(path)
-
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Invalid file: %s\n", err)
+	if *domain == "" {
+		*domain = GetDomain(env)
+	}
+	if *format == "zone" && *domain == "" {
+		fmt.Fprint(os.Stderr, "The zone format requires --domain\n")
 		os.Exit(1)
 	}
 
-	var s stateAnyTerraformVersion
+	var names, paths []string
+	for _, file := range files {
+		name, path := ParseInputSource(file)
+
+		if path != stdinPath && parseBackendURL(path) == nil {
+			var err error
+			path, err = filepath.Abs(path)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Invalid file: %s\n", err)
+				os.Exit(1)
+			}
+		}
+
+		names = append(names, name)
+		paths = append(paths, path)
+	}
 
-	if !f.IsDir() {
-		stateFile, err := os.Open(path)
-		defer stateFile.Close()
+	conf := &Config{}
+	if fn := GetConfigPath(fs, env, paths[0]); fn != "" {
+		var err error
+		conf, err = LoadConfig(fs, fn)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error opening tfstate file: %s\n", err)
+			fmt.Fprintf(os.Stderr, "Error reading config file: %s\n", err)
+			os.Exit(1)
+		}
+	}
+	for _, p := range conf.Providers {
+		providers.register(p)
+	}
+	if bin := GetTerraformBinary(env); bin != "" {
+		conf.Terraform.Binary = bin
+	}
+	if passphrase := GetEncryptionPassphrase(env); passphrase != "" {
+		conf.Encryption.Passphrase = passphrase
+	}
+	if f := GetHostvarsFormat(env); f != "" {
+		if f != HostvarsFormatFlat && f != HostvarsFormatTyped {
+			fmt.Fprintf(os.Stderr, "Unknown TF_HOSTVARS_FORMAT %s, expected %s or %s\n", f, HostvarsFormatFlat, HostvarsFormatTyped)
 			os.Exit(1)
 		}
+		conf.HostvarsFormat = f
+	}
 
-		err = s.read(stateFile)
+	var states []*stateAnyTerraformVersion
+	for i, path := range paths {
+		ss, err := readStates(fs, env, &conf.Terraform, &conf.Encryption, path, *workspace)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error reading tfstate file: %s\n", err)
+			fmt.Fprintf(os.Stderr, "%s\n\n"+usage, err, os.Args[0])
 			os.Exit(1)
 		}
+		for _, s := range ss {
+			s.Name = joinNames(names[i], s.Name)
+		}
+
+		states = append(states, ss...)
 	}
 
-	if f.IsDir() {
-		cmd := exec.Command("terraform", "show", "-json")
-		cmd.Dir = path
-		var out bytes.Buffer
-		cmd.Stdout = &out
+	if *list || *inventory {
+		switch *format {
+		case "json":
+			os.Exit(cmdList(os.Stdout, os.Stderr, states, conf))
+		case "ini":
+			os.Exit(cmdInventory(os.Stdout, os.Stderr, states, conf))
+		case "yaml":
+			os.Exit(cmdYAML(os.Stdout, os.Stderr, states, conf))
+		case "ssh":
+			os.Exit(cmdSSH(os.Stdout, os.Stderr, states, conf))
+		case "hosts":
+			os.Exit(cmdHosts(os.Stdout, os.Stderr, states))
+		case "zone":
+			os.Exit(cmdZone(os.Stdout, os.Stderr, states, *domain))
+		case "prometheus":
+			os.Exit(cmdPrometheus(os.Stdout, os.Stderr, states, conf))
+		}
+	} else if *host != "" {
+		os.Exit(cmdHost(os.Stdout, os.Stderr, states, *host, conf))
+	}
+}
 
-		err = cmd.Run()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error running `terraform show -json` in directory %s, %s, falling back to trying Terraform pre-0.12 command\n", path, err)
+// stdinPath is the path which stands for stdin.
+const stdinPath = "-"
+
+// stdin is where states are read from for stdinPath. It can be read only once.
+var stdin io.Reader = os.Stdin
+
+// readStates reads the states from the given path, which is either a state
+// file, a Terraform project directory, the URL of a remote backend or stdin. For the
+// workspace `*`, it reads the state of every workspace, named after the
+// workspace. Otherwise it reads a single state. State files and stdin have no
+// workspaces, so selecting one is an error.
+func readStates(fs vfs.Filesystem, env venv.Env, tf *Terraform, enc *Encryption, path string, workspace string) ([]*stateAnyTerraformVersion, error) {
+	var b backend
+	source := path
 
-			cmd = exec.Command("terraform", "state", "pull")
-			cmd.Dir = path
-			out.Reset()
-			cmd.Stdout = &out
-			err = cmd.Run()
+	if path == stdinPath {
+		if workspace != "" {
+			return nil, fmt.Errorf("Can't read workspace %s from stdin, it has a single state", workspace)
+		}
+		s, err := readStateStdin(enc)
+		if err != nil {
+			return nil, err
+		}
+		return []*stateAnyTerraformVersion{s}, nil
+	} else if u := parseBackendURL(path); u != nil {
+		var err error
+		b, err = backendTypes[u.Scheme](u, fs, env)
+		if err != nil {
+			return nil, err
+		}
+		source = backendSource(u)
+	} else {
+		f, err := fs.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid file: %s", err)
+		}
 
+		if !f.IsDir() {
+			if workspace != "" {
+				return nil, fmt.Errorf("Can't read workspace %s from the state file %s, it has a single state", workspace, path)
+			}
+			s, err := readStateFile(path, enc)
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error running `terraform state pull` in directory %s, %s\n", path, err)
-				os.Exit(1)
+				return nil, err
 			}
+			return []*stateAnyTerraformVersion{s}, nil
 		}
 
-		err = s.read(&out)
+		b = &projectBackend{tf: tf, dir: path}
+	}
 
+	if workspace != allWorkspaces {
+		s, err := readBackendState(b, source, workspace, enc)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error reading Terraform state: %s\n", err)
-			os.Exit(1)
+			return nil, err
 		}
+		return []*stateAnyTerraformVersion{s}, nil
 	}
 
+	workspaces, err := b.workspaces()
+	if err != nil {
+		return nil, err
+	}
+
+	// Workspaces without resources (e.g. an unused default workspace) have no
+	// readable state, so they are skipped.
+	var states []*stateAnyTerraformVersion
+	for _, ws := range workspaces {
+		s, err := readBackendState(b, source, ws, enc)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping workspace %s: %s\n", ws, err)
+			continue
+		}
+		s.Name = ws
+		states = append(states, s)
+	}
+
+	if len(states) == 0 {
+		return nil, fmt.Errorf("No workspace with a state found in %s", source)
+	}
+
+	return states, nil
+}
+
+// readStateFile reads the state from a state file.
+func readStateFile(path string, enc *Encryption) (*stateAnyTerraformVersion, error) {
+	s := &stateAnyTerraformVersion{Source: path}
+
+	stateFile, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening tfstate file: %s", err)
+	}
+	defer stateFile.Close()
+
+	err = s.read(stateFile, enc)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading tfstate file %s: %s", path, err)
+	}
+
+	return s, checkState(s)
+}
+
+// readStateStdin reads the state from stdin.
+func readStateStdin(enc *Encryption) (*stateAnyTerraformVersion, error) {
+	if stdin == nil {
+		return nil, fmt.Errorf("stdin (-) can only be read once")
+	}
+
+	s := &stateAnyTerraformVersion{Source: "stdin"}
+	err := s.read(stdin, enc)
+	stdin = nil
+	if err != nil {
+		return nil, fmt.Errorf("Error reading state from stdin: %s", err)
+	}
+
+	return s, checkState(s)
+}
+
+// readBackendState reads the state of the given workspace from a backend.
+func readBackendState(b backend, source string, workspace string, enc *Encryption) (*stateAnyTerraformVersion, error) {
+	s := &stateAnyTerraformVersion{Source: source}
+	if workspace != "" {
+		s.Source = fmt.Sprintf("%s (workspace %s)", source, workspace)
+	}
+
+	out, err := b.state(workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.read(out, enc)
+
+	if err != nil {
+		return nil, fmt.Errorf("Error reading Terraform state from %s: %s", s.Source, err)
+	}
+
+	return s, checkState(s)
+}
+
+// checkState returns an error if the state doesn't contain any modules.
+func checkState(s *stateAnyTerraformVersion) error {
 	if s.TerraformVersion == TerraformVersionUnknown {
-		fmt.Fprintf(os.Stderr, "Unknown state format\n\nUsage: %s [options] path\npath: this is either a path to a state file or a folder from which `terraform commands` are valid\n", os.Args[0])
-		os.Exit(1)
+		return fmt.Errorf("Unknown state format in %s", s.Source)
 	}
 
 	if (s.TerraformVersion == TerraformVersionPre0dot12 && s.StatePre0dot12.Modules == nil) ||
 		(s.TerraformVersion == TerraformVersion0dot12 && s.State0dot12.Values.RootModule == nil) {
-		fmt.Fprintf(os.Stderr, "No modules found in state\n\nUsage: %s [options] path\npath: this is either a path to a state file or a folder from which `terraform commands` are valid\n", os.Args[0])
-		os.Exit(1)
+		return fmt.Errorf("No modules found in state %s", s.Source)
 	}
 
-	if *list {
-		os.Exit(cmdList(os.Stdout, os.Stderr, &s))
-	} else if *inventory {
-		os.Exit(cmdInventory(os.Stdout, os.Stderr, &s))
-	} else if *host != "" {
-		os.Exit(cmdHost(os.Stdout, os.Stderr, &s, *host))
+	return nil
+}
+
+// joinNames joins the name of an input source and the name of one of its
+// states (e.g. its workspace) into a group name. Either may be empty.
+func joinNames(name string, stateName string) string {
+	if name == "" || stateName == "" {
+		return name + stateName
 	}
+	return name + "_" + stateName
 }
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/adammck/venv"
+	"github.com/blang/vfs/memfs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadStatesStdin(t *testing.T) {
+	defer func(r io.Reader) { stdin = r }(stdin)
+	stdin = strings.NewReader(exampleStateFileTerraform0dot12)
+
+	states, err := readStates(memfs.Create(), venv.Mock(), &Terraform{}, &Encryption{}, stdinPath, "")
+	assert.NoError(t, err)
+	assert.Len(t, states, 1)
+	assert.Equal(t, "stdin", states[0].Source)
+
+	var stdout, stderr bytes.Buffer
+	exitCode := cmdList(&stdout, &stderr, states, &Config{})
+	assert.Equal(t, 0, exitCode)
+
+	var act map[string]interface{}
+	err = json.Unmarshal(stdout.Bytes(), &act)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, act["all"].(map[string]interface{})["hosts"])
+
+	// stdin can be read only once
+	_, err = readStates(memfs.Create(), venv.Mock(), &Terraform{}, &Encryption{}, stdinPath, "")
+	assert.Error(t, err)
+
+	// stdin has no workspaces
+	stdin = strings.NewReader(exampleStateFileTerraform0dot12)
+	_, err = readStates(memfs.Create(), venv.Mock(), &Terraform{}, &Encryption{}, stdinPath, "prod")
+	assert.EqualError(t, err, "Can't read workspace prod from stdin, it has a single state")
+
+	stdin = strings.NewReader("nope")
+	_, err = readStates(memfs.Create(), venv.Mock(), &Terraform{}, &Encryption{}, stdinPath, "")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "stdin")
+}
+
+func TestReadStatesFileWorkspace(t *testing.T) {
+	fs := memfs.Create()
+	f, err := fs.OpenFile("/terraform.tfstate", os.O_CREATE|os.O_WRONLY, 0644)
+	assert.NoError(t, err)
+	f.Close()
+
+	_, err = readStates(fs, venv.Mock(), &Terraform{}, &Encryption{}, "/terraform.tfstate", allWorkspaces)
+	assert.EqualError(t, err, "Can't read workspace * from the state file /terraform.tfstate, it has a single state")
+}
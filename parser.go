@@ -6,6 +6,7 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -29,6 +30,13 @@ type stateAnyTerraformVersion struct {
 	StatePre0dot12   state
 	State0dot12      stateTerraform0dot12
 	TerraformVersion TerraformVersion
+
+	// Where the state was read from, e.g. the path. Only used in messages.
+	Source string
+
+	// Optional name of the state. If set, all hosts of the state are put into a
+	// group of this name.
+	Name string
 }
 
 // Terraform < v0.12
@@ -48,6 +56,9 @@ type resourceState struct {
 type instanceState struct {
 	ID         string            `json:"id"`
 	Attributes map[string]string `json:"attributes,omitempty"`
+
+	// Only set for Terraform >= v0.12, where Attributes is a flattened copy
+	RawValues map[string]interface{} `json:"-"`
 }
 
 // Terraform <= v0.12
@@ -65,14 +76,38 @@ type moduleStateTerraform0dot12 struct {
 }
 type resourceStateTerraform0dot12 struct {
 	Address   string                 `json:"address"`
+	Mode      string                 `json:"mode"`  // "managed", "data" or (OpenTofu) "ephemeral"
 	Index     *interface{}           `json:"index"` // only set by Terraform for counted resources
 	Name      string                 `json:"name"`
 	RawValues map[string]interface{} `json:"values"`
 	Type      string                 `json:"type"`
 }
 
-// read populates the state object from a statefile.
-func (s *stateAnyTerraformVersion) read(stateFile io.Reader) error {
+// Terraform >= v0.12 raw state file (format version 4), as written to
+// `terraform.tfstate` or returned by `terraform state pull`
+type stateTerraformV4 struct {
+	Version   int                        `json:"version"`
+	Outputs   map[string]interface{}     `json:"outputs"`
+	Resources []resourceStateTerraformV4 `json:"resources"`
+}
+type resourceStateTerraformV4 struct {
+	Module    string                     `json:"module"` // empty for root module, else e.g. `module.a.module.b`
+	Mode      string                     `json:"mode"`   // "managed", "data" or (OpenTofu) "ephemeral"
+	Type      string                     `json:"type"`
+	Name      string                     `json:"name"`
+	Each      string                     `json:"each"` // "list" for `count`, "map" for `for_each`, else empty
+	Instances []instanceStateTerraformV4 `json:"instances"`
+}
+type instanceStateTerraformV4 struct {
+	IndexKey       interface{}            `json:"index_key"`
+	Deposed        string                 `json:"deposed"`
+	Attributes     map[string]interface{} `json:"attributes"`
+	AttributesFlat map[string]string      `json:"attributes_flat"` // legacy providers only
+}
+
+// read populates the state object from a statefile, which is decrypted with
+// the given settings if it's encrypted.
+func (s *stateAnyTerraformVersion) read(stateFile io.Reader, enc *Encryption) error {
 	s.TerraformVersion = TerraformVersionUnknown
 
 	b, readErr := ioutil.ReadAll(stateFile)
@@ -80,19 +115,128 @@ func (s *stateAnyTerraformVersion) read(stateFile io.Reader) error {
 		return readErr
 	}
 
+	// Compressed and encrypted states are decoded first
+	b, decodeErr := decodeState(b, enc)
+	if decodeErr != nil {
+		return decodeErr
+	}
+
 	err0dot12 := json.Unmarshal(b, &(*s).State0dot12)
 	if err0dot12 == nil && s.State0dot12.Values.RootModule != nil {
 		s.TerraformVersion = TerraformVersion0dot12
-	} else {
-		errPre0dot12 := json.Unmarshal(b, &(*s).StatePre0dot12)
-		if errPre0dot12 == nil && s.StatePre0dot12.Modules != nil {
-			s.TerraformVersion = TerraformVersionPre0dot12
-		} else {
-			return fmt.Errorf("0.12 format error: %v; pre-0.12 format error: %v (nil error means no content/modules found in the respective format)", err0dot12, errPre0dot12)
+		return nil
+	}
+
+	// A raw state file is converted to the `terraform show -json` structure,
+	// so that the rest of the code only has to deal with one >= 0.12 format.
+	var stateV4 stateTerraformV4
+	errV4 := json.Unmarshal(b, &stateV4)
+	if errV4 == nil && stateV4.Version == 4 {
+		s.State0dot12 = stateV4.toTerraform0dot12()
+		s.TerraformVersion = TerraformVersion0dot12
+		return nil
+	}
+
+	errPre0dot12 := json.Unmarshal(b, &(*s).StatePre0dot12)
+	if errPre0dot12 == nil && s.StatePre0dot12.Modules != nil {
+		s.TerraformVersion = TerraformVersionPre0dot12
+		return nil
+	}
+
+	return fmt.Errorf("0.12 format error: %v; state v4 format error: %v; pre-0.12 format error: %v (nil error means no content/modules found in the respective format)", err0dot12, errV4, errPre0dot12)
+}
+
+// toTerraform0dot12 converts a raw version 4 state into the structure which
+// `terraform show -json` would have returned for it.
+func (s *stateTerraformV4) toTerraform0dot12() stateTerraform0dot12 {
+	root := &moduleStateTerraform0dot12{}
+	modules := map[string]*moduleStateTerraform0dot12{"": root}
+
+	for _, rs := range s.Resources {
+		module := getOrAddChildModule(modules, rs.Module)
+
+		address := rs.Type + "." + rs.Name
+		if rs.Mode != "" && rs.Mode != "managed" {
+			address = rs.Mode + "." + address
 		}
+		if rs.Module != "" {
+			address = rs.Module + "." + address
+		}
+
+		for _, is := range rs.Instances {
+			if is.Deposed != "" {
+				// Replaced object which is about to be destroyed
+				continue
+			}
+
+			values := is.Attributes
+			if values == nil {
+				values = make(map[string]interface{}, len(is.AttributesFlat))
+				for k, v := range is.AttributesFlat {
+					values[k] = v
+				}
+			}
+
+			r := resourceStateTerraform0dot12{
+				Address:   address,
+				Mode:      rs.Mode,
+				Name:      rs.Name,
+				RawValues: values,
+				Type:      rs.Type,
+			}
+			if is.IndexKey != nil {
+				index := is.IndexKey
+				r.Index = &index
+				r.Address += fmt.Sprintf("[%s]", encodeIndexKey(index))
+			}
+
+			module.ResourceStates = append(module.ResourceStates, r)
+		}
+	}
+
+	return stateTerraform0dot12{
+		Values: valuesStateTerraform0dot12{
+			RootModule: root,
+			Outputs:    s.Outputs,
+		},
+	}
+}
+
+// getOrAddChildModule returns the module with the given address, creating it
+// and any missing parents along the way. Addresses look like
+// `module.a.module.b`, optionally with instance keys, e.g. `module.a[0]`.
+func getOrAddChildModule(modules map[string]*moduleStateTerraform0dot12, address string) *moduleStateTerraform0dot12 {
+	if m, exists := modules[address]; exists {
+		return m
+	}
+
+	parentAddress := ""
+	if i := strings.LastIndex(address, ".module."); i >= 0 {
+		parentAddress = address[:i]
 	}
+	parent := getOrAddChildModule(modules, parentAddress)
 
-	return nil
+	parent.ChildModules = append(parent.ChildModules, moduleStateTerraform0dot12{Address: address})
+
+	// Appending may have moved the parent's children, so re-index all of them.
+	for i := range parent.ChildModules {
+		modules[parent.ChildModules[i].Address] = &parent.ChildModules[i]
+	}
+
+	return modules[address]
+}
+
+// encodeIndexKey formats a resource instance key the way Terraform does in
+// resource addresses, i.e. numbers verbatim and strings quoted.
+func encodeIndexKey(key interface{}) string {
+	switch v := key.(type) {
+	case float64:
+		return strconv.Itoa(int(v))
+	case string:
+		return strconv.Quote(v)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
 }
 
 // outputs returns a slice of the Outputs found in the statefile.
@@ -219,9 +363,34 @@ func (s *stateAnyTerraformVersion) resources() []*Resource {
 	panic("Unimplemented Terraform version enum")
 }
 
+// outputs returns a slice of the Outputs found in the statefile.
+func (s *stateAnyTerraformVersion) outputs() []*Output {
+	switch s.TerraformVersion {
+	case TerraformVersionPre0dot12:
+		return s.StatePre0dot12.outputs()
+	case TerraformVersion0dot12:
+		return s.State0dot12.outputs()
+	case TerraformVersionUnknown:
+	}
+	panic("Unimplemented Terraform version enum")
+}
+
+// mapResourceIDNames returns the names of the resources by their IDs.
+func (s *stateAnyTerraformVersion) mapResourceIDNames() map[string]string {
+	switch s.TerraformVersion {
+	case TerraformVersionPre0dot12:
+		return s.StatePre0dot12.mapResourceIDNames()
+	case TerraformVersion0dot12:
+		return s.State0dot12.mapResourceIDNames()
+	case TerraformVersionUnknown:
+	}
+	panic("Unimplemented Terraform version enum")
+}
+
 // resources returns a slice of the Resources found in the statefile.
 func (s *state) resources() []*Resource {
 	inst := make([]*Resource, 0)
+	all := make([]*Resource, 0)
 
 	for _, m := range s.Modules {
 		for _, k := range m.resourceKeys() {
@@ -262,9 +431,16 @@ func (s *state) resources() []*Resource {
 				fmt.Fprintf(os.Stderr, "Warning: failed to parse resource %s (%v)\n", asJSON, err)
 				continue
 			}
-			if r.IsSupported() {
-				inst = append(inst, r)
-			}
+			r.moduleAddress = m.address()
+			r.address = addressPre0dot12(r.moduleAddress, k)
+			all = append(all, r)
+		}
+	}
+
+	resolveAddresses(all)
+	for _, r := range all {
+		if r.IsSupported() {
+			inst = append(inst, r)
 		}
 	}
 
@@ -311,9 +487,14 @@ func encodeTerraform0Dot12ValuesAsAttributes(rawValues *map[string]interface{})
 	return ret
 }
 
+// invalidKeyNameChars matches the characters which can't be part of the name of
+// a resource keyName, see nameParser.
+var invalidKeyNameChars = regexp.MustCompile(`[^\w\-]`)
+
 // resources returns a slice of the Resources found in the statefile.
 func (s *stateTerraform0dot12) resources() []*Resource {
 	inst := make([]*Resource, 0)
+	all := make([]*Resource, 0)
 
 	for _, module := range s.getAllModules() {
 		for _, rs := range module.ResourceStates {
@@ -322,14 +503,16 @@ func (s *stateTerraform0dot12) resources() []*Resource {
 				continue
 			}
 
-			if strings.HasPrefix(rs.Address, "data.") {
+			if (rs.Mode != "" && rs.Mode != "managed") || strings.HasPrefix(rs.Address, "data.") {
 				// This does not represent a host (e.g. AWS AMI)
 				continue
 			}
 
+			// the keyName can't contain the brackets and quotes of module
+			// instances, e.g. `module.app[0]` becomes `module_app_0_`
 			modulePrefix := ""
-			if module.Address != "" {
-				modulePrefix = strings.Replace(module.Address, ".", "_", -1) + "_"
+			if names := moduleNames(module.Address); len(names) > 0 {
+				modulePrefix = invalidKeyNameChars.ReplaceAllString(names[len(names)-1], "_") + "_"
 			}
 			resourceKeyName := rs.Type + "." + modulePrefix + rs.Name
 			if rs.Index != nil {
@@ -356,6 +539,7 @@ func (s *stateTerraform0dot12) resources() []*Resource {
 				Primary: instanceState{
 					ID:         id,
 					Attributes: encodeTerraform0Dot12ValuesAsAttributes(&rs.RawValues),
+					RawValues:  rs.RawValues,
 				},
 			})
 			if err != nil {
@@ -363,9 +547,19 @@ func (s *stateTerraform0dot12) resources() []*Resource {
 				fmt.Fprintf(os.Stderr, "Warning: failed to parse resource %s (%v)\n", asJSON, err)
 				continue
 			}
-			if r.IsSupported() {
-				inst = append(inst, r)
+			r.moduleAddress = module.Address
+			r.address = rs.Address
+			if module.Address != "" && !strings.HasPrefix(r.address, module.Address+".") {
+				r.address = module.Address + "." + r.address
 			}
+			all = append(all, r)
+		}
+	}
+
+	resolveAddresses(all)
+	for _, r := range all {
+		if r.IsSupported() {
+			inst = append(inst, r)
 		}
 	}
 
@@ -376,6 +570,33 @@ func (s *stateTerraform0dot12) resources() []*Resource {
 	return inst
 }
 
+// address returns the module address in Terraform >= 0.12 syntax, e.g.
+// `module.a.module.b` for the path ["root", "a", "b"], or an empty string for
+// the root module.
+func (ms *moduleState) address() string {
+	var parts []string
+	for i, name := range ms.Path {
+		if i == 0 && name == "root" {
+			continue
+		}
+		parts = append(parts, "module."+name)
+	}
+	return strings.Join(parts, ".")
+}
+
+// addressPre0dot12 converts a pre-0.12 resource key like `aws_instance.web.0`
+// into a Terraform >= 0.12 address like `module.a.aws_instance.web[0]`.
+func addressPre0dot12(moduleAddress string, key string) string {
+	address := key
+	if parts := strings.SplitN(key, ".", 3); len(parts) == 3 {
+		address = fmt.Sprintf("%s.%s[%s]", parts[0], parts[1], parts[2])
+	}
+	if moduleAddress != "" {
+		address = moduleAddress + "." + address
+	}
+	return address
+}
+
 // resourceKeys returns a sorted slice of the key names of the resources in this
 // module. Do this instead of range over ResourceStates, to ensure that the
 // output is consistent.
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"os"
+	"sort"
 	"strings"
 	"testing"
 
@@ -44,9 +45,23 @@ const expectedListOutputEnvHostname = `
 		"vars": {
 		}
 	},
-	"fourteen":	 ["fourteen"],
+	"_meta": {
+		"hostvars": {
+			"fourteen": {
+				"ansible_host": "192.168.102.14",
+				"name": "fourteen",
+				"network_interface.#": "1",
+				"network_interface.0.addresses.#": "1",
+				"network_interface.0.addresses.0": "192.168.102.14",
+				"network_interface.0.mac": "96:EE:4D:BD:B2:45"
+			}
+		}
+	},
+	"fourteen":	 {"hosts": ["fourteen"], "children": ["fourteen_0"]},
 	"fourteen_0":	 ["fourteen"],
-	"type_libvirt_domain": ["fourteen"]
+	"type_libvirt_domain": ["fourteen"],
+
+	"terraform_types": {"children": ["type_libvirt_domain"]}
 }`
 
 const exampleStateFile = `
@@ -444,8 +459,8 @@ const exampleStateFile = `
 							"tags.#": "0"
 						}
 					}
-				}
-				"telmate_proxmox.nineteen": {
+				},
+				"telmate_proxmox.twenty": {
 					"type": "telmate_proxmox",
 					"primary": {
 						"id": "proxmox/qemu/100",
@@ -478,12 +493,13 @@ const expectedListOutput = `
 			"10.120.0.226",
 			"10.2.1.5",
 			"10.20.30.40",
+			"10.20.30.50",
 			"192.168.0.3",
+			"192.168.1.123",
 			"192.168.102.14",
 			"50.0.0.1",
 			"50.0.0.17",
-			"80.80.100.124",
-			"10.20.30.50"
+			"80.80.100.124"
 		],
 		"vars": {
 			"datacenter": "mydc",
@@ -492,27 +508,27 @@ const expectedListOutput = `
 			"map": {"key": "value"}
 		}
 	},
-	"one":	 ["10.0.0.1", "10.0.1.1"],
-	"dup":	 ["10.0.0.1"],
-	"two":	 ["50.0.0.1"],
-	"three": ["192.168.0.3"],
-	"four":  ["10.2.1.5"],
-	"five":  ["10.20.30.40"],
-	"six":	 ["10.120.0.226"],
-	"seven": ["10.0.0.7"],
-	"eight": ["10.0.0.8"],
-	"nine": ["10.0.0.9"],
-	"ten": ["10.0.0.10"],
-	"eleven": ["10.0.0.11"],
-	"twelve": ["10.20.30.50"],
+	"one":	 {"hosts": ["10.0.0.1", "10.0.1.1"], "children": ["one_0", "one_1"]},
+	"dup":	 {"hosts": ["10.0.0.1"], "children": ["dup_0"]},
+	"two":	 {"hosts": ["50.0.0.1"], "children": ["two_0"]},
+	"three": {"hosts": ["192.168.0.3"], "children": ["three_0"]},
+	"four":  {"hosts": ["10.2.1.5"], "children": ["four_0"]},
+	"five":  {"hosts": ["10.20.30.40"], "children": ["five_0"]},
+	"six":	 {"hosts": ["10.120.0.226"], "children": ["six_0"]},
+	"seven": {"hosts": ["10.0.0.7"], "children": ["seven_0"]},
+	"eight": {"hosts": ["10.0.0.8"], "children": ["eight_0"]},
+	"nine": {"hosts": ["10.0.0.9"], "children": ["nine_0"]},
+	"ten": {"hosts": ["10.0.0.10"], "children": ["ten_0"]},
+	"eleven": {"hosts": ["10.0.0.11"], "children": ["eleven_0"]},
+	"twelve": {"hosts": ["10.20.30.50"], "children": ["twelve_0"]},
 	"testTag1": ["10.20.30.50"],
-	"thirteen": ["10.0.0.13"],
-	"fourteen": ["192.168.102.14"],
-	"nineteen": ["10.0.0.19"],
-	"sixteen": ["10.0.0.16"],
-	"seventeen": ["50.0.0.17"],
-	"eighteen": ["80.80.100.124"],
-	"nineteen": ["192.168.1.123"],
+	"thirteen": {"hosts": ["10.0.0.13"], "children": ["thirteen_0"]},
+	"fourteen": {"hosts": ["192.168.102.14"], "children": ["fourteen_0"]},
+	"nineteen": {"hosts": ["10.0.0.19"], "children": ["nineteen_0"]},
+	"sixteen": {"hosts": ["10.0.0.16"], "children": ["sixteen_0"]},
+	"seventeen": {"hosts": ["50.0.0.17"], "children": ["seventeen_0"]},
+	"eighteen": {"hosts": ["80.80.100.124"], "children": ["eighteen_0"]},
+	"twenty": {"hosts": ["192.168.1.123"], "children": ["twenty_0"]},
 
 	"one_0":   ["10.0.0.1"],
 	"dup_0":   ["10.0.0.1"],
@@ -534,7 +550,7 @@ const expectedListOutput = `
 	"sixteen_0": ["10.0.0.16"],
 	"seventeen_0": ["50.0.0.17"],
 	"eighteen_0": ["80.80.100.124"],
-	"nineteen_0": ["192.168.1.123"],
+	"twenty_0": ["192.168.1.123"],
 
 	"type_aws_instance":                  ["10.0.0.1", "10.0.1.1", "50.0.0.1"],
 	"type_digitalocean_droplet":          ["192.168.0.3"],
@@ -566,37 +582,59 @@ const expectedListOutput = `
 	"database": ["10.0.0.8"],
 	"scw_test": ["10.0.0.11"],
 	"tfinventory_rocks": ["10.0.0.19"],
-	"superman_clarkkent": ["10.0.0.19"]
+	"superman_clarkkent": ["10.0.0.19"],
+
+	"ostags": {"children": ["ostags_rock"]},
+	"role": {"children": ["role_nine", "role_rrrrrrrr", "role_test", "role_web", "role_worker"]},
+	"status": {"children": ["status_superserver"]},
+	"superman": {"children": ["superman_clarkkent"]},
+	"terraform_types": {"children": ["type_aws_instance", "type_aws_spot_instance_request", "type_cloudstack_instance", "type_digitalocean_droplet", "type_exoscale_compute", "type_google_compute_instance", "type_libvirt_domain", "type_linode_instance", "type_openstack_compute_instance_v2", "type_opentelekomcloud_compute_instance_v2", "type_packet_device", "type_profitbricks_server", "type_scaleway_server", "type_softlayer_virtual_guest", "type_telmate_proxmox", "type_triton_machine", "type_vsphere_virtual_machine"]},
+	"tfinventory": {"children": ["tfinventory_rocks"]},
+
+	"facility": {"children": ["facility_ewr1"]},
+	"facility_ewr1": ["10.0.0.13"],
+	"package": {"children": ["package_g4_highcpu_1G"]},
+	"package_g4_highcpu_1G": ["10.0.0.10"],
+	"plan": {"children": ["plan_baremetal_0"]},
+	"plan_baremetal_0": ["10.0.0.13"],
+	"service_offering": {"children": ["service_offering_small"]},
+	"service_offering_small": ["10.2.1.5"],
+	"size": {"children": ["size_zzz"]},
+	"size_zzz": ["10.0.0.9"],
+	"zone": {"children": ["zone_ch_gva_2", "zone_europe_west1_d", "zone_nyc2"]},
+	"zone_ch_gva_2": ["10.0.0.9"],
+	"zone_europe_west1_d": ["10.0.0.8"],
+	"zone_nyc2": ["10.2.1.5"]
 }
 `
 
 const expectedInventoryOutput = `[all]
-10.0.0.1
-10.0.0.10
-10.0.0.11
-10.0.0.13
-10.0.0.16
-10.0.0.19
-10.0.0.7
-10.0.0.8
-10.0.0.9
-10.0.1.1
-10.120.0.226
-10.2.1.5
-10.20.30.40
-192.168.0.3
-192.168.102.14
-50.0.0.1
-50.0.0.17
-80.80.100.124
-192.168.1.123
-10.20.30.50
+10.0.0.1 ansible_host='"10.0.0.1"'
+10.0.0.10 ansible_host='"10.0.0.10"'
+10.0.0.11 ansible_host='"10.0.0.11"'
+10.0.0.13 ansible_host='"10.0.0.13"'
+10.0.0.16 ansible_host='"10.0.0.16"'
+10.0.0.19 ansible_host='"10.0.0.19"'
+10.0.0.7 ansible_host='"10.0.0.7"'
+10.0.0.8 ansible_host='"10.0.0.8"'
+10.0.0.9 ansible_host='"10.0.0.9"'
+10.0.1.1 ansible_host='"10.0.1.1"'
+10.120.0.226 ansible_host='"10.120.0.226"'
+10.2.1.5 ansible_host='"10.2.1.5"'
+10.20.30.40 ansible_host='"10.20.30.40"'
+10.20.30.50 ansible_host='"10.20.30.50"'
+192.168.0.3 ansible_host='"192.168.0.3"'
+192.168.1.123 ansible_host='"192.168.1.123"'
+192.168.102.14 ansible_host='"192.168.102.14"'
+50.0.0.1 ansible_host='"50.0.0.1"'
+50.0.0.17 ansible_host='"50.0.0.17"'
+80.80.100.124 ansible_host='"80.80.100.124"'
 
 [all:vars]
 datacenter="mydc"
 ids=[1,2,3,4]
 map={"key":"value"}
-olddatacenter="\u003c0.7_format"
+olddatacenter="<0.7_format"
 
 [database]
 10.0.0.8
@@ -604,60 +642,89 @@ olddatacenter="\u003c0.7_format"
 [dup]
 10.0.0.1
 
+[dup:children]
+dup_0
+
 [dup_0]
 10.0.0.1
 
 [eight]
 10.0.0.8
 
+[eight:children]
+eight_0
+
 [eight_0]
 10.0.0.8
 
 [eighteen]
 80.80.100.124
 
-[eighteen_0]
-80.80.100.124
-
-[nineteen]
-80.80.100.124
+[eighteen:children]
+eighteen_0
 
-[nineteen_0]
+[eighteen_0]
 80.80.100.124
 
 [eleven]
 10.0.0.11
 
+[eleven:children]
+eleven_0
+
 [eleven_0]
 10.0.0.11
 
+[facility]
+
+[facility:children]
+facility_ewr1
+
+[facility_ewr1]
+10.0.0.13
+
 [five]
 10.20.30.40
 
+[five:children]
+five_0
+
 [five_0]
 10.20.30.40
 
 [four]
 10.2.1.5
 
+[four:children]
+four_0
+
 [four_0]
 10.2.1.5
 
 [fourteen]
 192.168.102.14
 
+[fourteen:children]
+fourteen_0
+
 [fourteen_0]
 192.168.102.14
 
 [nine]
 10.0.0.9
 
+[nine:children]
+nine_0
+
 [nine_0]
 10.0.0.9
 
 [nineteen]
 10.0.0.19
 
+[nineteen:children]
+nineteen_0
+
 [nineteen_0]
 10.0.0.19
 
@@ -665,15 +732,49 @@ olddatacenter="\u003c0.7_format"
 10.0.0.1
 10.0.1.1
 
+[one:children]
+one_0
+one_1
+
 [one_0]
 10.0.0.1
 
 [one_1]
 10.0.1.1
 
+[ostags]
+
+[ostags:children]
+ostags_rock
+
 [ostags_rock]
 10.120.0.226
 
+[package]
+
+[package:children]
+package_g4_highcpu_1G
+
+[package_g4_highcpu_1G]
+10.0.0.10
+
+[plan]
+
+[plan:children]
+plan_baremetal_0
+
+[plan_baremetal_0]
+10.0.0.13
+
+[role]
+
+[role:children]
+role_nine
+role_rrrrrrrr
+role_test
+role_web
+role_worker
+
 [role_nine]
 10.0.0.9
 
@@ -692,72 +793,160 @@ olddatacenter="\u003c0.7_format"
 [scw_test]
 10.0.0.11
 
+[service_offering]
+
+[service_offering:children]
+service_offering_small
+
+[service_offering_small]
+10.2.1.5
+
 [seven]
 10.0.0.7
 
+[seven:children]
+seven_0
+
 [seven_0]
 10.0.0.7
 
 [seventeen]
 50.0.0.17
 
+[seventeen:children]
+seventeen_0
+
 [seventeen_0]
 50.0.0.17
 
 [six]
 10.120.0.226
 
+[six:children]
+six_0
+
 [six_0]
 10.120.0.226
 
 [sixteen]
 10.0.0.16
 
+[sixteen:children]
+sixteen_0
+
 [sixteen_0]
 10.0.0.16
 
+[size]
+
+[size:children]
+size_zzz
+
+[size_zzz]
+10.0.0.9
+
 [staging]
 192.168.0.3
 
+[status]
+
+[status:children]
+status_superserver
+
 [status_superserver]
 10.120.0.226
 
+[superman]
+
+[superman:children]
+superman_clarkkent
+
 [superman_clarkkent]
 10.0.0.19
 
 [ten]
 10.0.0.10
 
+[ten:children]
+ten_0
+
 [ten_0]
 10.0.0.10
 
+[terraform_types]
+
+[terraform_types:children]
+type_aws_instance
+type_aws_spot_instance_request
+type_cloudstack_instance
+type_digitalocean_droplet
+type_exoscale_compute
+type_google_compute_instance
+type_libvirt_domain
+type_linode_instance
+type_openstack_compute_instance_v2
+type_opentelekomcloud_compute_instance_v2
+type_packet_device
+type_profitbricks_server
+type_scaleway_server
+type_softlayer_virtual_guest
+type_telmate_proxmox
+type_triton_machine
+type_vsphere_virtual_machine
+
 [testTag1]
 10.20.30.50
 
+[tfinventory]
+
+[tfinventory:children]
+tfinventory_rocks
+
 [tfinventory_rocks]
 10.0.0.19
 
 [thirteen]
 10.0.0.13
 
+[thirteen:children]
+thirteen_0
+
 [thirteen_0]
 10.0.0.13
 
 [three]
 192.168.0.3
 
+[three:children]
+three_0
+
 [three_0]
 192.168.0.3
 
 [twelve]
 10.20.30.50
 
+[twelve:children]
+twelve_0
+
 [twelve_0]
 10.20.30.50
 
+[twenty]
+192.168.1.123
+
+[twenty:children]
+twenty_0
+
+[twenty_0]
+192.168.1.123
+
 [two]
 50.0.0.1
 
+[two:children]
+two_0
+
 [two_0]
 50.0.0.1
 
@@ -787,9 +976,6 @@ olddatacenter="\u003c0.7_format"
 [type_linode_instance]
 80.80.100.124
 
-[type_telmate_proxmox]
-191.168.1.123
-
 [type_openstack_compute_instance_v2]
 10.120.0.226
 
@@ -808,6 +994,9 @@ olddatacenter="\u003c0.7_format"
 [type_softlayer_virtual_guest]
 10.0.0.7
 
+[type_telmate_proxmox]
+192.168.1.123
+
 [type_triton_machine]
 10.0.0.10
 
@@ -818,6 +1007,22 @@ olddatacenter="\u003c0.7_format"
 [webserver]
 192.168.0.3
 
+[zone]
+
+[zone:children]
+zone_ch_gva_2
+zone_europe_west1_d
+zone_nyc2
+
+[zone_ch_gva_2]
+10.0.0.9
+
+[zone_europe_west1_d]
+10.0.0.8
+
+[zone_nyc2]
+10.2.1.5
+
 `
 
 const expectedHostOneOutput = `
@@ -833,7 +1038,7 @@ const expectedHostOneOutput = `
 func TestListCommand(t *testing.T) {
 	var s stateAnyTerraformVersion
 	r := strings.NewReader(exampleStateFile)
-	err := s.read(r)
+	err := s.read(r, &Encryption{})
 	assert.NoError(t, err)
 
 	assert.Equal(t, TerraformVersionPre0dot12, s.TerraformVersion)
@@ -845,7 +1050,7 @@ func TestListCommand(t *testing.T) {
 
 	// Run the command, capture the output
 	var stdout, stderr bytes.Buffer
-	exitCode := cmdList(&stdout, &stderr, &s)
+	exitCode := cmdList(&stdout, &stderr, []*stateAnyTerraformVersion{&s}, &Config{})
 	assert.Equal(t, 0, exitCode)
 	assert.Equal(t, "", stderr.String())
 
@@ -854,13 +1059,14 @@ func TestListCommand(t *testing.T) {
 	err = json.Unmarshal([]byte(stdout.String()), &act)
 	assert.NoError(t, err)
 
+	assertHostvarsMatchHostCommand(t, &s, act)
 	assert.Equal(t, exp, act)
 }
 
 func TestListCommandEnvHostname(t *testing.T) {
 	var s stateAnyTerraformVersion
 	r := strings.NewReader(exampleStateFileEnvHostname)
-	err := s.read(r)
+	err := s.read(r, &Encryption{})
 	assert.NoError(t, err)
 
 	assert.Equal(t, TerraformVersionPre0dot12, s.TerraformVersion)
@@ -873,7 +1079,7 @@ func TestListCommandEnvHostname(t *testing.T) {
 	// Run the command, capture the output
 	var stdout, stderr bytes.Buffer
 	os.Setenv("TF_HOSTNAME_KEY_NAME", "name")
-	exitCode := cmdList(&stdout, &stderr, &s)
+	exitCode := cmdList(&stdout, &stderr, []*stateAnyTerraformVersion{&s}, &Config{})
 	os.Unsetenv("TF_HOSTNAME_KEY_NAME")
 	assert.Equal(t, 0, exitCode)
 	assert.Equal(t, "", stderr.String())
@@ -889,7 +1095,7 @@ func TestListCommandEnvHostname(t *testing.T) {
 func TestHostCommand(t *testing.T) {
 	var s stateAnyTerraformVersion
 	r := strings.NewReader(exampleStateFile)
-	err := s.read(r)
+	err := s.read(r, &Encryption{})
 	assert.NoError(t, err)
 
 	assert.Equal(t, TerraformVersionPre0dot12, s.TerraformVersion)
@@ -901,7 +1107,7 @@ func TestHostCommand(t *testing.T) {
 
 	// Run the command, capture the output
 	var stdout, stderr bytes.Buffer
-	exitCode := cmdHost(&stdout, &stderr, &s, "10.0.0.1")
+	exitCode := cmdHost(&stdout, &stderr, []*stateAnyTerraformVersion{&s}, "10.0.0.1", &Config{})
 	assert.Equal(t, 0, exitCode)
 	assert.Equal(t, "", stderr.String())
 
@@ -916,20 +1122,47 @@ func TestHostCommand(t *testing.T) {
 func TestInventoryCommand(t *testing.T) {
 	var s stateAnyTerraformVersion
 	r := strings.NewReader(exampleStateFile)
-	err := s.read(r)
+	err := s.read(r, &Encryption{})
 	assert.NoError(t, err)
 
 	assert.Equal(t, TerraformVersionPre0dot12, s.TerraformVersion)
 
 	// Run the command, capture the output
 	var stdout, stderr bytes.Buffer
-	exitCode := cmdInventory(&stdout, &stderr, &s)
+	exitCode := cmdInventory(&stdout, &stderr, []*stateAnyTerraformVersion{&s}, &Config{})
 	assert.Equal(t, 0, exitCode)
 	assert.Equal(t, "", stderr.String())
 
 	assert.Equal(t, expectedInventoryOutput, stdout.String())
 }
 
+// assertHostvarsMatchHostCommand checks that the `_meta` section of a decoded
+// `--list` output contains exactly what `--host` returns for every host, then
+// removes it so that the rest of the output can be compared as a whole.
+func assertHostvarsMatchHostCommand(t *testing.T, s *stateAnyTerraformVersion, act interface{}) {
+	assertHostvarsMatchHostCommandStates(t, []*stateAnyTerraformVersion{s}, act)
+}
+
+func assertHostvarsMatchHostCommandStates(t *testing.T, states []*stateAnyTerraformVersion, act interface{}) {
+	groups := act.(map[string]interface{})
+	hostvars := groups["_meta"].(map[string]interface{})["hostvars"].(map[string]interface{})
+	hosts := groups["all"].(map[string]interface{})["hosts"].([]interface{})
+	assert.Len(t, hostvars, len(hosts))
+
+	for _, host := range hosts {
+		var stdout, stderr bytes.Buffer
+		exitCode := cmdHost(&stdout, &stderr, states, host.(string), &Config{})
+		assert.Equal(t, 0, exitCode)
+
+		var exp interface{}
+		err := json.Unmarshal(stdout.Bytes(), &exp)
+		assert.NoError(t, err)
+		assert.Equal(t, exp, hostvars[host.(string)])
+	}
+
+	delete(groups, "_meta")
+}
+
 //
 // Terraform 0.12 BEGIN
 //
@@ -1283,15 +1516,15 @@ const expectedListOutputTerraform0dot12 = `
 		}
 	},
 	"one_0": ["35.159.25.34"],
-	"one": ["35.159.25.34"],
+	"one": {"hosts": ["35.159.25.34"], "children": ["one_0"]},
 	"module_my-module-four_host_for_each_example_first": ["10.0.0.4"],
 	"module_my-module-four_host_for_each_example_second": ["10.0.1.4"],
-	"module_my-module-four_host": ["10.0.0.4", "10.0.1.4"],
+	"module_my-module-four_host": {"hosts": ["10.0.0.4", "10.0.1.4"], "children": ["module_my-module-four_host_for_each_example_first", "module_my-module-four_host_for_each_example_second"]},
 	"module_my-module-two_host_0": ["10.0.0.2"],
-	"module_my-module-two_host": ["10.0.0.2"],
+	"module_my-module-two_host": {"hosts": ["10.0.0.2"], "children": ["module_my-module-two_host_0"]},
 	"module_my-module-three_host_0": ["10.0.0.3"],
 	"module_my-module-three_host_1": ["10.0.1.3"],
-	"module_my-module-three_host": ["10.0.0.3", "10.0.1.3"],
+	"module_my-module-three_host": {"hosts": ["10.0.0.3", "10.0.1.3"], "children": ["module_my-module-three_host_0", "module_my-module-three_host_1"]},
 
 	"type_aws_instance": ["10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.1.3", "10.0.1.4", "35.159.25.34"],
 
@@ -1305,21 +1538,34 @@ const expectedListOutputTerraform0dot12 = `
 	"foo_bar": ["12.34.56.78"],
 	"type_vsphere_virtual_machine": ["12.34.56.78"],
 	"vm_0": ["12.34.56.78"],
-	"vm": ["12.34.56.78"]
+	"vm": {"hosts": ["12.34.56.78"], "children": ["vm_0"]},
+
+	"additional": {"children": ["additional_another-tag"]},
+	"name": {"children": ["name_four-aws-instance", "name_one-aws-instance", "name_three-aws-instance", "name_two-aws-instance"]},
+	"terraform_types": {"children": ["type_aws_instance", "type_vsphere_virtual_machine"]},
+
+	"module_my-module-four": ["10.0.0.4", "10.0.1.4"],
+	"module_my-module-three": ["10.0.0.3", "10.0.1.3"],
+	"module_my-module-two": ["10.0.0.2"]
 }
 `
 
-const expectedInventoryOutputTerraform0dot12 = `[additional_another-tag]
+const expectedInventoryOutputTerraform0dot12 = `[additional]
+
+[additional:children]
+additional_another-tag
+
+[additional_another-tag]
 35.159.25.34
 
 [all]
-10.0.0.2
-10.0.0.3
-10.0.0.4
-10.0.1.3
-10.0.1.4
-12.34.56.78
-35.159.25.34
+10.0.0.2 ansible_host='"10.0.0.2"'
+10.0.0.3 ansible_host='"10.0.0.3"'
+10.0.0.4 ansible_host='"10.0.0.4"'
+10.0.1.3 ansible_host='"10.0.1.3"'
+10.0.1.4 ansible_host='"10.0.1.4"'
+12.34.56.78 ansible_host='"12.34.56.78"'
+35.159.25.34 ansible_host='"35.159.25.34"'
 
 [all:vars]
 map={"first":"a","second":"b"}
@@ -1329,32 +1575,62 @@ my_password="1234"
 [foo_bar]
 12.34.56.78
 
+[module_my-module-four]
+10.0.0.4
+10.0.1.4
+
 [module_my-module-four_host]
 10.0.0.4
 10.0.1.4
 
+[module_my-module-four_host:children]
+module_my-module-four_host_for_each_example_first
+module_my-module-four_host_for_each_example_second
+
 [module_my-module-four_host_for_each_example_first]
 10.0.0.4
 
 [module_my-module-four_host_for_each_example_second]
 10.0.1.4
 
+[module_my-module-three]
+10.0.0.3
+10.0.1.3
+
 [module_my-module-three_host]
 10.0.0.3
 10.0.1.3
 
+[module_my-module-three_host:children]
+module_my-module-three_host_0
+module_my-module-three_host_1
+
 [module_my-module-three_host_0]
 10.0.0.3
 
 [module_my-module-three_host_1]
 10.0.1.3
 
+[module_my-module-two]
+10.0.0.2
+
 [module_my-module-two_host]
 10.0.0.2
 
+[module_my-module-two_host:children]
+module_my-module-two_host_0
+
 [module_my-module-two_host_0]
 10.0.0.2
 
+[name]
+
+[name:children]
+name_four-aws-instance
+name_one-aws-instance
+name_three-aws-instance
+name_two-aws-instance
+
 [name_four-aws-instance]
 10.0.0.4
 10.0.1.4
@@ -1372,9 +1648,18 @@ my_password="1234"
 [one]
 35.159.25.34
 
+[one:children]
+one_0
+
 [one_0]
 35.159.25.34
 
+[terraform_types]
+
+[terraform_types:children]
+type_aws_instance
+type_vsphere_virtual_machine
+
 [type_aws_instance]
 10.0.0.2
 10.0.0.3
@@ -1389,6 +1674,9 @@ my_password="1234"
 [vm]
 12.34.56.78
 
+[vm:children]
+vm_0
+
 [vm_0]
 12.34.56.78
 
@@ -1413,7 +1701,7 @@ const expectedHostOneOutputTerraform0dot12 = `
 func TestListCommandTerraform0dot12(t *testing.T) {
 	var s stateAnyTerraformVersion
 	r := strings.NewReader(exampleStateFileTerraform0dot12)
-	err := s.read(r)
+	err := s.read(r, &Encryption{})
 	assert.NoError(t, err)
 
 	assert.Equal(t, TerraformVersion0dot12, s.TerraformVersion)
@@ -1425,22 +1713,23 @@ func TestListCommandTerraform0dot12(t *testing.T) {
 
 	// Run the command, capture the output
 	var stdout, stderr bytes.Buffer
-	exitCode := cmdList(&stdout, &stderr, &s)
+	exitCode := cmdList(&stdout, &stderr, []*stateAnyTerraformVersion{&s}, &Config{})
 	assert.Equal(t, 0, exitCode)
-	assert.Equal(t, "", stderr.String())
+	assert.Equal(t, "16 group names aren't valid in Ansible, e.g. additional_another-tag, see group_names.sanitize\n", stderr.String())
 
 	// Decode the output to compare
 	var act interface{}
 	err = json.Unmarshal([]byte(stdout.String()), &act)
 	assert.NoError(t, err)
 
+	assertHostvarsMatchHostCommand(t, &s, act)
 	assert.Equal(t, exp, act)
 }
 
 func TestHostCommandTerraform0dot12(t *testing.T) {
 	var s stateAnyTerraformVersion
 	r := strings.NewReader(exampleStateFileTerraform0dot12)
-	err := s.read(r)
+	err := s.read(r, &Encryption{})
 	assert.NoError(t, err)
 
 	assert.Equal(t, TerraformVersion0dot12, s.TerraformVersion)
@@ -1452,7 +1741,7 @@ func TestHostCommandTerraform0dot12(t *testing.T) {
 
 	// Run the command, capture the output
 	var stdout, stderr bytes.Buffer
-	exitCode := cmdHost(&stdout, &stderr, &s, "35.159.25.34")
+	exitCode := cmdHost(&stdout, &stderr, []*stateAnyTerraformVersion{&s}, "35.159.25.34", &Config{})
 	assert.Equal(t, 0, exitCode)
 	assert.Equal(t, "", stderr.String())
 
@@ -1467,16 +1756,16 @@ func TestHostCommandTerraform0dot12(t *testing.T) {
 func TestInventoryCommandTerraform0dot12(t *testing.T) {
 	var s stateAnyTerraformVersion
 	r := strings.NewReader(exampleStateFileTerraform0dot12)
-	err := s.read(r)
+	err := s.read(r, &Encryption{})
 	assert.NoError(t, err)
 
 	assert.Equal(t, TerraformVersion0dot12, s.TerraformVersion)
 
 	// Run the command, capture the output
 	var stdout, stderr bytes.Buffer
-	exitCode := cmdInventory(&stdout, &stderr, &s)
+	exitCode := cmdInventory(&stdout, &stderr, []*stateAnyTerraformVersion{&s}, &Config{})
 	assert.Equal(t, 0, exitCode)
-	assert.Equal(t, "", stderr.String())
+	assert.Equal(t, "16 group names aren't valid in Ansible, e.g. additional_another-tag, see group_names.sanitize\n", stderr.String())
 
 	assert.Equal(t, expectedInventoryOutputTerraform0dot12, stdout.String())
 }
@@ -1484,3 +1773,412 @@ func TestInventoryCommandTerraform0dot12(t *testing.T) {
 //
 // Terraform 0.12 END
 //
+
+//
+// Terraform state v4 BEGIN
+//
+
+const exampleStateFileTerraformV4 = `
+{
+	"version": 4,
+	"terraform_version": "1.5.7",
+	"serial": 12,
+	"lineage": "5b1c3d4e-0000-0000-0000-000000000000",
+	"outputs": {
+		"my_endpoint": {
+			"value": "a.b.c.d.example.com",
+			"type": "string"
+		},
+		"my_password": {
+			"value": "1234",
+			"type": "string",
+			"sensitive": true
+		}
+	},
+	"resources": [
+		{
+			"mode": "data",
+			"type": "aws_ami",
+			"name": "ubuntu",
+			"provider": "provider[\"registry.terraform.io/hashicorp/aws\"]",
+			"instances": [
+				{
+					"schema_version": 0,
+					"attributes": {
+						"id": "ami-00000000000000000",
+						"public_ip": "1.1.1.1"
+					}
+				}
+			]
+		},
+		{
+			"mode": "managed",
+			"type": "aws_instance",
+			"name": "one",
+			"provider": "provider[\"registry.terraform.io/hashicorp/aws\"]",
+			"instances": [
+				{
+					"schema_version": 1,
+					"attributes": {
+						"ami": "ami-00000000000000000",
+						"id": "i-11111111111111111",
+						"monitoring": false,
+						"private_ip": "10.0.0.1",
+						"public_ip": "35.159.25.34",
+						"tags": {
+							"Role": "web"
+						}
+					}
+				},
+				{
+					"schema_version": 1,
+					"deposed": "00000001",
+					"attributes": {
+						"id": "i-00000000000000000",
+						"private_ip": "10.0.0.99",
+						"public_ip": "35.159.25.99"
+					}
+				}
+			]
+		},
+		{
+			"module": "module.my-module-two",
+			"mode": "managed",
+			"type": "aws_instance",
+			"name": "host",
+			"each": "list",
+			"provider": "provider[\"registry.terraform.io/hashicorp/aws\"]",
+			"instances": [
+				{
+					"index_key": 0,
+					"schema_version": 1,
+					"attributes": {
+						"id": "i-22222222222222222",
+						"private_ip": "10.0.0.2",
+						"tags": {
+							"Role": "worker"
+						}
+					}
+				},
+				{
+					"index_key": 1,
+					"schema_version": 1,
+					"attributes": {
+						"id": "i-33333333333333333",
+						"private_ip": "10.0.1.2",
+						"tags": {
+							"Role": "worker"
+						}
+					}
+				}
+			]
+		},
+		{
+			"module": "module.my-module-two.module.db",
+			"mode": "managed",
+			"type": "aws_instance",
+			"name": "host",
+			"each": "map",
+			"provider": "provider[\"registry.terraform.io/hashicorp/aws\"]",
+			"instances": [
+				{
+					"index_key": "primary",
+					"schema_version": 1,
+					"attributes": {
+						"id": "i-44444444444444444",
+						"private_ip": "10.0.0.4"
+					}
+				}
+			]
+		},
+		{
+			"mode": "managed",
+			"type": "digitalocean_droplet",
+			"name": "legacy",
+			"provider": "provider.digitalocean",
+			"instances": [
+				{
+					"schema_version": 0,
+					"attributes_flat": {
+						"id": "5555555",
+						"ipv4_address": "192.168.0.5",
+						"tags.#": "1",
+						"tags.0": "archived"
+					}
+				}
+			]
+		}
+	]
+}
+`
+
+const expectedListOutputTerraformV4 = `
+{
+	"all": {
+		"hosts": [
+			"10.0.0.2",
+			"10.0.0.4",
+			"10.0.1.2",
+			"192.168.0.5",
+			"35.159.25.34"
+		],
+		"vars": {
+			"my_endpoint": "a.b.c.d.example.com",
+			"my_password": "1234"
+		}
+	},
+	"one": {"hosts": ["35.159.25.34"], "children": ["one_0"]},
+	"one_0": ["35.159.25.34"],
+	"legacy": {"hosts": ["192.168.0.5"], "children": ["legacy_0"]},
+	"legacy_0": ["192.168.0.5"],
+	"module_my-module-two_host": {"hosts": ["10.0.0.2", "10.0.1.2"], "children": ["module_my-module-two_host_0", "module_my-module-two_host_1"]},
+	"module_my-module-two_host_0": ["10.0.0.2"],
+	"module_my-module-two_host_1": ["10.0.1.2"],
+	"module_my-module-two_module_db_host": {"hosts": ["10.0.0.4"], "children": ["module_my-module-two_module_db_host_primary"]},
+	"module_my-module-two_module_db_host_primary": ["10.0.0.4"],
+
+	"type_aws_instance": ["10.0.0.2", "10.0.0.4", "10.0.1.2", "35.159.25.34"],
+	"type_digitalocean_droplet": ["192.168.0.5"],
+
+	"archived": ["192.168.0.5"],
+	"role_web": ["35.159.25.34"],
+	"role_worker": ["10.0.0.2", "10.0.1.2"],
+
+	"role": {"children": ["role_web", "role_worker"]},
+	"terraform_types": {"children": ["type_aws_instance", "type_digitalocean_droplet"]},
+
+	"module_my-module-two": ["10.0.0.2", "10.0.0.4", "10.0.1.2"],
+	"module_my-module-two_module_db": ["10.0.0.4"]
+}
+`
+
+const expectedHostOneOutputTerraformV4 = `
+{
+	"ami": "ami-00000000000000000",
+	"ansible_host": "35.159.25.34",
+	"id": "i-11111111111111111",
+	"monitoring": "<error>",
+	"private_ip": "10.0.0.1",
+	"public_ip": "35.159.25.34",
+	"tags.#": "1",
+	"tags.Role": "web"
+}
+`
+
+func TestListCommandTerraformV4(t *testing.T) {
+	var s stateAnyTerraformVersion
+	r := strings.NewReader(exampleStateFileTerraformV4)
+	err := s.read(r, &Encryption{})
+	assert.NoError(t, err)
+
+	assert.Equal(t, TerraformVersion0dot12, s.TerraformVersion)
+
+	// Decode expectation as JSON
+	var exp interface{}
+	err = json.Unmarshal([]byte(expectedListOutputTerraformV4), &exp)
+	assert.NoError(t, err)
+
+	// Run the command, capture the output
+	var stdout, stderr bytes.Buffer
+	exitCode := cmdList(&stdout, &stderr, []*stateAnyTerraformVersion{&s}, &Config{})
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, "7 group names aren't valid in Ansible, e.g. module_my-module-two, see group_names.sanitize\n", stderr.String())
+
+	// Decode the output to compare
+	var act interface{}
+	err = json.Unmarshal([]byte(stdout.String()), &act)
+	assert.NoError(t, err)
+
+	assertHostvarsMatchHostCommand(t, &s, act)
+	assert.Equal(t, exp, act)
+}
+
+func TestHostCommandTerraformV4(t *testing.T) {
+	var s stateAnyTerraformVersion
+	r := strings.NewReader(exampleStateFileTerraformV4)
+	err := s.read(r, &Encryption{})
+	assert.NoError(t, err)
+
+	assert.Equal(t, TerraformVersion0dot12, s.TerraformVersion)
+
+	// Decode expectation as JSON
+	var exp interface{}
+	err = json.Unmarshal([]byte(expectedHostOneOutputTerraformV4), &exp)
+	assert.NoError(t, err)
+
+	// Run the command, capture the output
+	var stdout, stderr bytes.Buffer
+	exitCode := cmdHost(&stdout, &stderr, []*stateAnyTerraformVersion{&s}, "35.159.25.34", &Config{})
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, "", stderr.String())
+
+	// Decode the output to compare
+	var act interface{}
+	err = json.Unmarshal([]byte(stdout.String()), &act)
+	assert.NoError(t, err)
+
+	assert.Equal(t, exp, act)
+}
+
+const expectedHostOneOutputTerraformV4Typed = `
+{
+	"ami": "ami-00000000000000000",
+	"ansible_host": "35.159.25.34",
+	"id": "i-11111111111111111",
+	"monitoring": false,
+	"private_ip": "10.0.0.1",
+	"public_ip": "35.159.25.34",
+	"tags": {
+		"Role": "web"
+	}
+}
+`
+
+func TestHostCommandTerraformV4Typed(t *testing.T) {
+	var s stateAnyTerraformVersion
+	r := strings.NewReader(exampleStateFileTerraformV4)
+	err := s.read(r, &Encryption{})
+	assert.NoError(t, err)
+
+	// Decode expectation as JSON
+	var exp interface{}
+	err = json.Unmarshal([]byte(expectedHostOneOutputTerraformV4Typed), &exp)
+	assert.NoError(t, err)
+
+	// Run the command, capture the output
+	var stdout, stderr bytes.Buffer
+	exitCode := cmdHost(&stdout, &stderr, []*stateAnyTerraformVersion{&s}, "35.159.25.34", &Config{HostvarsFormat: HostvarsFormatTyped})
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, "", stderr.String())
+
+	// Decode the output to compare
+	var act interface{}
+	err = json.Unmarshal([]byte(stdout.String()), &act)
+	assert.NoError(t, err)
+
+	assert.Equal(t, exp, act)
+}
+
+func TestHostCommandTypedPre0dot12(t *testing.T) {
+	var s stateAnyTerraformVersion
+	r := strings.NewReader(exampleStateFile)
+	err := s.read(r, &Encryption{})
+	assert.NoError(t, err)
+
+	// Pre-0.12 state has no typed values, so the flat attributes are used
+	var exp interface{}
+	err = json.Unmarshal([]byte(expectedHostOneOutput), &exp)
+	assert.NoError(t, err)
+
+	var stdout, stderr bytes.Buffer
+	exitCode := cmdHost(&stdout, &stderr, []*stateAnyTerraformVersion{&s}, "10.0.0.1", &Config{HostvarsFormat: HostvarsFormatTyped})
+	assert.Equal(t, 0, exitCode)
+
+	var act interface{}
+	err = json.Unmarshal([]byte(stdout.String()), &act)
+	assert.NoError(t, err)
+
+	assert.Equal(t, exp, act)
+}
+
+func TestConvertTerraformV4Modules(t *testing.T) {
+	var s stateAnyTerraformVersion
+	r := strings.NewReader(exampleStateFileTerraformV4)
+	err := s.read(r, &Encryption{})
+	assert.NoError(t, err)
+
+	root := s.State0dot12.Values.RootModule
+	assert.Equal(t, "", root.Address)
+	assert.Len(t, root.ResourceStates, 3)
+	assert.Equal(t, "data.aws_ami.ubuntu", root.ResourceStates[0].Address)
+	assert.Equal(t, "aws_instance.one", root.ResourceStates[1].Address)
+
+	assert.Len(t, root.ChildModules, 1)
+	two := root.ChildModules[0]
+	assert.Equal(t, "module.my-module-two", two.Address)
+	assert.Equal(t, "module.my-module-two.aws_instance.host[1]", two.ResourceStates[1].Address)
+
+	assert.Len(t, two.ChildModules, 1)
+	db := two.ChildModules[0]
+	assert.Equal(t, "module.my-module-two.module.db", db.Address)
+	assert.Equal(t, `module.my-module-two.module.db.aws_instance.host["primary"]`, db.ResourceStates[0].Address)
+}
+
+func TestTerraformV4ModuleInstanceResources(t *testing.T) {
+	var s stateAnyTerraformVersion
+	err := s.read(strings.NewReader(exampleStateFileModuleInstances), &Encryption{})
+	assert.NoError(t, err)
+
+	addresses := []string{}
+	for _, r := range s.resources() {
+		addresses = append(addresses, r.address)
+	}
+	sort.Strings(addresses)
+	assert.Equal(t, []string{
+		"aws_instance.web",
+		`module.app["x"].aws_instance.host[0]`,
+		`module.app["x"].aws_instance.host[1]`,
+		"module.app[0].aws_instance.host",
+	}, addresses)
+}
+
+const exampleStateFileOpenTofu = `
+{
+	"version": 4,
+	"terraform_version": "1.8.3",
+	"serial": 7,
+	"lineage": "00000000-0000-0000-0000-000000000000",
+	"outputs": {},
+	"resources": [
+		{
+			"mode": "managed",
+			"type": "aws_instance",
+			"name": "web",
+			"provider": "provider[\"registry.opentofu.org/hashicorp/aws\"]",
+			"instances": [
+				{
+					"schema_version": 1,
+					"status": "tainted",
+					"attributes": {"id": "i-11111111", "private_ip": "10.0.0.1"},
+					"sensitive_attributes": [[{"type": "get_attr", "value": "user_data"}]],
+					"private": "eyJzY2hlbWFfdmVyc2lvbiI6IjEifQ==",
+					"dependencies": ["data.aws_ami.ubuntu"]
+				}
+			]
+		},
+		{
+			"mode": "ephemeral",
+			"type": "aws_secretsmanager_secret_version",
+			"name": "password",
+			"provider": "provider[\"registry.opentofu.org/hashicorp/aws\"]",
+			"instances": [
+				{"attributes": {"id": "arn:aws:secretsmanager:eu-central-1:1:secret:db", "private_ip": "10.0.0.2"}}
+			]
+		}
+	],
+	"check_results": [
+		{"object_kind": "resource", "config_addr": "aws_instance.web", "status": "pass", "objects": []}
+	]
+}
+`
+
+func TestOpenTofuState(t *testing.T) {
+	var s stateAnyTerraformVersion
+	r := strings.NewReader(exampleStateFileOpenTofu)
+	err := s.read(r, &Encryption{})
+	assert.NoError(t, err)
+	assert.Equal(t, TerraformVersion0dot12, s.TerraformVersion)
+
+	root := s.State0dot12.Values.RootModule
+	assert.Equal(t, "ephemeral.aws_secretsmanager_secret_version.password", root.ResourceStates[1].Address)
+
+	// Only managed resources are hosts
+	resources := s.resources()
+	assert.Len(t, resources, 1)
+	assert.Equal(t, "aws_instance.web", resources[0].address)
+	assert.Equal(t, "10.0.0.1", resources[0].Address())
+}
+
+//
+// Terraform state v4 END
+//
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultPrometheusPort is the port of node_exporter.
+const defaultPrometheusPort = 9100
+
+// Prometheus holds the settings of the `prometheus` output format, which writes
+// targets for Prometheus' file-based service discovery.
+type Prometheus struct {
+
+	// Port to scrape on every host, by default 9100 (node_exporter).
+	Port int `yaml:"port"`
+
+	// Whether there is a target group per resource type (`type`, the default)
+	// or per inventory group (`group`).
+	GroupBy string `yaml:"group_by"`
+
+	// Inventory groups to write for `group_by: group`, by default every group
+	// but `all`.
+	Groups []string `yaml:"groups"`
+}
+
+// prometheusTargetGroup is a target group of Prometheus' file_sd_configs.
+type prometheusTargetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// prometheusTargetGroups returns the target groups for the resources of the
+// given states. Hosts of the same resource type (or inventory group) with
+// different labels are put into separate target groups, as labels apply to
+// every target of a group.
+func prometheusTargetGroups(states []*stateAnyTerraformVersion, conf *Config, stderr io.Writer) ([]*prometheusTargetGroup, error) {
+	port := conf.Prometheus.Port
+	if port == 0 {
+		port = defaultPrometheusPort
+	}
+
+	// the resources by hostname, the first resource wins like in `--host`
+	resources := make(map[string]*Resource)
+	for _, s := range states {
+		for _, res := range s.resources() {
+			if _, exists := resources[res.Hostname()]; !exists {
+				resources[res.Hostname()] = res
+			}
+		}
+	}
+
+	members := make(map[string][]string)
+	if conf.Prometheus.GroupBy == "group" {
+		inventory, err := gatherInventory(states, conf, stderr)
+		if err != nil {
+			return nil, err
+		}
+		for name, grp := range inventory {
+			if name == "all" || (len(conf.Prometheus.Groups) > 0 && !contains(conf.Prometheus.Groups, name)) {
+				continue
+			}
+			switch grp := grp.(type) {
+			case []string:
+				members[name] = grp
+			case *parentGroup:
+				members[name] = grp.Hosts
+			}
+		}
+	} else {
+		for hostname, res := range resources {
+			members[res.resourceType] = append(members[res.resourceType], hostname)
+		}
+	}
+
+	groups := make(map[string]*prometheusTargetGroup)
+	for name, hosts := range members {
+		for _, hostname := range hosts {
+			res, exists := resources[hostname]
+			if !exists {
+				continue
+			}
+
+			labels := prometheusLabels(res)
+			if conf.Prometheus.GroupBy == "group" {
+				labels["group"] = name
+			}
+			key, _ := json.Marshal(labels)
+
+			grp, exists := groups[string(key)]
+			if !exists {
+				grp = &prometheusTargetGroup{Labels: labels}
+				groups[string(key)] = grp
+			}
+			grp.Targets = appendUniq(grp.Targets, net.JoinHostPort(res.Address(), strconv.Itoa(port)))
+			sort.Strings(grp.Targets)
+		}
+	}
+
+	keys := []string{}
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := make([]*prometheusTargetGroup, len(keys))
+	for i, key := range keys {
+		result[i] = groups[key]
+	}
+	return result, nil
+}
+
+// prometheusLabels returns the labels of a host: its resource type, the address
+// of its module, and its tags as `tag_<key>`. Valueless tags have the value
+// `true`.
+func prometheusLabels(res *Resource) map[string]string {
+	labels := map[string]string{"terraform_type": res.resourceType}
+	if res.moduleAddress != "" {
+		labels["terraform_module"] = res.moduleAddress
+	}
+
+	for k, v := range res.Tags() {
+		if v == "" {
+			v = "true"
+		}
+		labels[prometheusLabelName("tag_"+k)] = v
+	}
+
+	return labels
+}
+
+// prometheusLabelName replaces the characters which aren't allowed in label
+// names with underscores.
+func prometheusLabelName(name string) string {
+	return strings.Map(func(c rune) rune {
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' {
+			return c
+		}
+		return '_'
+	}, name)
+}
+
+func cmdPrometheus(stdout io.Writer, stderr io.Writer, states []*stateAnyTerraformVersion, conf *Config) int {
+	groups, err := prometheusTargetGroups(states, conf, stderr)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error gathering inventory: %s\n", err)
+		return 1
+	}
+
+	return output(stdout, stderr, groups)
+}
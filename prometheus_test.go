@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const expectedPrometheusOutputTerraformV4 = `
+[
+	{
+		"targets": ["192.168.0.5:9100"],
+		"labels": {"tag_archived": "true", "terraform_type": "digitalocean_droplet"}
+	},
+	{
+		"targets": ["35.159.25.34:9100"],
+		"labels": {"tag_role": "web", "terraform_type": "aws_instance"}
+	},
+	{
+		"targets": ["10.0.0.2:9100", "10.0.1.2:9100"],
+		"labels": {"tag_role": "worker", "terraform_module": "module.my-module-two", "terraform_type": "aws_instance"}
+	},
+	{
+		"targets": ["10.0.0.4:9100"],
+		"labels": {"terraform_module": "module.my-module-two.module.db", "terraform_type": "aws_instance"}
+	}
+]
+`
+
+func TestPrometheusCommand(t *testing.T) {
+	s := readTestState(t, exampleStateFileTerraformV4, "v4.tfstate", "")
+
+	var stdout, stderr bytes.Buffer
+	exitCode := cmdPrometheus(&stdout, &stderr, []*stateAnyTerraformVersion{s}, &Config{})
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, "", stderr.String())
+	assert.JSONEq(t, expectedPrometheusOutputTerraformV4, stdout.String())
+}
+
+func TestPrometheusCommandByGroup(t *testing.T) {
+	s := readTestState(t, exampleStateFileTerraformV4, "v4.tfstate", "")
+	conf := &Config{Prometheus: Prometheus{GroupBy: "group", Port: 9273, Groups: []string{"role_web"}}}
+
+	var stdout, stderr bytes.Buffer
+	exitCode := cmdPrometheus(&stdout, &stderr, []*stateAnyTerraformVersion{s}, conf)
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, "7 group names aren't valid in Ansible, e.g. module_my-module-two, see group_names.sanitize\n", stderr.String())
+	assert.JSONEq(t, `[
+		{
+			"targets": ["35.159.25.34:9273"],
+			"labels": {"group": "role_web", "tag_role": "web", "terraform_type": "aws_instance"}
+		}
+	]`, stdout.String())
+}
+
+func TestPrometheusLabelName(t *testing.T) {
+	assert.Equal(t, "tag_role", prometheusLabelName("tag_role"))
+	assert.Equal(t, "tag_kubernetes_io_role", prometheusLabelName("tag_kubernetes.io/role"))
+}
+
+func TestPrometheusTargetsIPv6(t *testing.T) {
+	s := readTestState(t, exampleStateFileHosts, "hosts.tfstate", "")
+
+	groups, _ := prometheusTargetGroups([]*stateAnyTerraformVersion{s}, &Config{}, &bytes.Buffer{})
+	targets := []string{}
+	for _, grp := range groups {
+		targets = append(targets, grp.Targets...)
+	}
+	assert.Contains(t, targets, "[2001:db8::1]:9100")
+}
@@ -0,0 +1,331 @@
+package main
+
+// TagStyle defines how the tag attributes of a provider are turned into tags.
+type TagStyle string
+
+const (
+	// TagStyleKeyValue means that tags are key/value pairs, e.g. the attribute
+	// `tags.Role = web` becomes the tag `role` with the value `web`.
+	TagStyleKeyValue TagStyle = "key_value"
+
+	// TagStyleValue means that tags are plain values, e.g. the attribute
+	// `tags.0 = web` becomes the valueless tag `web`.
+	TagStyleValue TagStyle = "value"
+)
+
+// Provider describes which resources of a Terraform provider represent hosts,
+// and where to find their address and tags.
+//
+// Additional providers can be defined in the config file, see Config.
+type Provider struct {
+	Name string `yaml:"name"`
+
+	// Resource types which represent hosts, e.g. `aws_instance`
+	ResourceTypes []string `yaml:"resource_types"`
+
+	// (Flattened) attributes which hold the address of a host, in order of
+	// priority, e.g. `public_ip` before `private_ip`
+	AddressAttributes []string `yaml:"address_attributes"`
+
+	// (Flattened) attributes which hold the hostname of a host, in order of
+	// priority. If none is set, the address is used as hostname.
+	HostnameAttributes []string `yaml:"hostname_attributes"`
+
+	// Map or list attributes which hold tags, labels or metadata, e.g. `tags`
+	TagAttributes []string `yaml:"tag_attributes"`
+	TagStyle      TagStyle `yaml:"tag_style"`
+
+	// Resource types which have address attributes, but never represent hosts
+	// themselves, e.g. `azurerm_public_ip`
+	IgnoredResourceTypes []string `yaml:"ignored_resource_types"`
+
+	// (Flattened) attributes which describe where a host runs and what it runs
+	// on, e.g. `availability_zone` and `instance_type`. Hosts are grouped by
+	// their values.
+	PlacementAttributes []string `yaml:"placement_attributes"`
+}
+
+// builtinProviders are the providers supported out of the box. To add a new
+// one, append it here.
+var builtinProviders = []*Provider{
+	{
+		Name:                "DigitalOcean",
+		ResourceTypes:       []string{"digitalocean_droplet"},
+		AddressAttributes:   []string{"ipv4_address"},
+		TagAttributes:       []string{"tags"},
+		TagStyle:            TagStyleValue,
+		PlacementAttributes: []string{"region", "size"},
+	},
+	{
+		Name:                "SoftLayer",
+		ResourceTypes:       []string{"softlayer_virtual_guest"},
+		AddressAttributes:   []string{"ipv4_address", "ipv4_address_private"},
+		PlacementAttributes: []string{"datacenter"},
+	},
+	{
+		Name:                "Hetzner Cloud",
+		ResourceTypes:       []string{"hcloud_server"},
+		AddressAttributes:   []string{"ipv4_address"},
+		TagAttributes:       []string{"labels"},
+		TagStyle:            TagStyleKeyValue,
+		PlacementAttributes: []string{"location", "datacenter", "server_type"},
+	},
+	{
+		Name:                 "AWS",
+		ResourceTypes:        []string{"aws_instance", "aws_spot_instance_request"},
+		AddressAttributes:    []string{"public_ip", "private_ip"},
+		TagAttributes:        []string{"tags", "tags_all"},
+		TagStyle:             TagStyleKeyValue,
+		IgnoredResourceTypes: []string{"aws_eip", "aws_eip_association", "aws_network_interface"},
+		PlacementAttributes:  []string{"availability_zone", "instance_type"},
+	},
+	{
+		Name:              "Scaleway",
+		ResourceTypes:     []string{"scaleway_server"},
+		AddressAttributes: []string{"public_ip", "public_ipv6", "private_ip"},
+		TagAttributes:     []string{"tags"},
+		TagStyle:          TagStyleValue,
+	},
+	{
+		Name:                "CloudStack",
+		ResourceTypes:       []string{"cloudstack_instance"},
+		AddressAttributes:   []string{"ipaddress"},
+		PlacementAttributes: []string{"zone", "service_offering"},
+	},
+	{
+		Name:              "ProfitBricks",
+		ResourceTypes:     []string{"profitbricks_server"},
+		AddressAttributes: []string{"primary_ip"},
+	},
+	{
+		Name:              "Cherry Servers",
+		ResourceTypes:     []string{"cherryservers_server"},
+		AddressAttributes: []string{"primary_ip"},
+	},
+	{
+		Name:              "VMware",
+		ResourceTypes:     []string{"vsphere_virtual_machine"},
+		AddressAttributes: []string{"ip_address", "network_interface.0.ipv4_address", "default_ip_address"},
+		TagAttributes:     []string{"custom_configuration_parameters", "tags"},
+		TagStyle:          TagStyleKeyValue,
+	},
+	{
+		Name:              "Docker",
+		ResourceTypes:     []string{"docker_container"},
+		AddressAttributes: []string{"ip_address"},
+	},
+	{
+		Name:                "Linode",
+		ResourceTypes:       []string{"linode_instance"},
+		AddressAttributes:   []string{"ip_address"},
+		TagAttributes:       []string{"tags", "tags_all"},
+		TagStyle:            TagStyleKeyValue,
+		PlacementAttributes: []string{"region"},
+	},
+	{
+		Name:              "OpenStack",
+		ResourceTypes:     []string{"openstack_compute_instance_v2"},
+		AddressAttributes: []string{"access_ip_v4", "floating_ip"},
+		TagAttributes:     []string{"tag", "metadata"},
+		TagStyle:          TagStyleKeyValue,
+		IgnoredResourceTypes: []string{
+			"openstack_compute_floatingip_v2",
+			"openstack_compute_floatingip_associate_v2",
+			"openstack_networking_floatingip_v2",
+			"openstack_networking_floatingip_associate_v2",
+			"openstack_networking_port_v2",
+		},
+		PlacementAttributes: []string{"availability_zone", "flavor_name"},
+	},
+	{
+		Name:                "Open Telekom Cloud",
+		ResourceTypes:       []string{"opentelekomcloud_compute_instance_v2"},
+		AddressAttributes:   []string{"access_ip_v4", "floating_ip"},
+		TagAttributes:       []string{"tag", "metadata"},
+		TagStyle:            TagStyleKeyValue,
+		PlacementAttributes: []string{"availability_zone", "flavor_name"},
+	},
+	{
+		Name:          "Google Compute Engine",
+		ResourceTypes: []string{"google_compute_instance"},
+		AddressAttributes: []string{
+			"network_interface.0.access_config.0.nat_ip",
+			"network_interface.0.access_config.0.assigned_nat_ip",
+			"network_interface.0.address",
+		},
+		TagAttributes:       []string{"tags"},
+		TagStyle:            TagStyleValue,
+		PlacementAttributes: []string{"zone", "machine_type"},
+	},
+	{
+		Name:                "Exoscale",
+		ResourceTypes:       []string{"exoscale_compute"},
+		AddressAttributes:   []string{"ip_address", "networks.0.ip4address"},
+		TagAttributes:       []string{"tags"},
+		TagStyle:            TagStyleKeyValue,
+		PlacementAttributes: []string{"zone", "size"},
+	},
+	{
+		Name:                "Joyent Triton",
+		ResourceTypes:       []string{"triton_machine"},
+		AddressAttributes:   []string{"primaryip"},
+		TagAttributes:       []string{"tags"},
+		TagStyle:            TagStyleKeyValue,
+		PlacementAttributes: []string{"package"},
+	},
+	{
+		Name:              "libvirt",
+		ResourceTypes:     []string{"libvirt_domain"},
+		AddressAttributes: []string{"network_interface.0.addresses.0"},
+	},
+	{
+		Name:                "Packet",
+		ResourceTypes:       []string{"packet_device"},
+		AddressAttributes:   []string{"network.0.address"},
+		PlacementAttributes: []string{"facility", "plan"},
+	},
+	{
+		Name:              "Nutanix",
+		ResourceTypes:     []string{"nutanix_virtual_machine"},
+		AddressAttributes: []string{"nic_list.0.ip_endpoint_list.0.ip"},
+	},
+	{
+		Name:                "Yandex.Cloud",
+		ResourceTypes:       []string{"yandex_compute_instance"},
+		AddressAttributes:   []string{"network_interface.0.nat_ip_address", "network_interface.0.ip_address"},
+		TagAttributes:       []string{"labels"},
+		TagStyle:            TagStyleKeyValue,
+		PlacementAttributes: []string{"zone", "platform_id"},
+	},
+	{
+		Name: "Azure",
+		ResourceTypes: []string{
+			"azurerm_linux_virtual_machine",
+			"azurerm_windows_virtual_machine",
+			"azurerm_virtual_machine",
+		},
+		AddressAttributes:    []string{"public_ip_address", "private_ip_address"},
+		TagAttributes:        []string{"tags"},
+		TagStyle:             TagStyleKeyValue,
+		IgnoredResourceTypes: []string{"azurerm_network_interface", "azurerm_public_ip"},
+		PlacementAttributes:  []string{"location", "size", "vm_size"},
+	},
+	{
+		Name:                "Telmate/Proxmox",
+		ResourceTypes:       []string{"proxmox_vm_qemu", "proxmox_lxc"},
+		AddressAttributes:   []string{"default_ipv4_address", "ssh_host"},
+		PlacementAttributes: []string{"target_node"},
+	},
+}
+
+// fallbackAddressAttributes are the attributes which may hold the address of a
+// resource of an unknown type, in order of priority. Public addresses come
+// before private ones.
+var fallbackAddressAttributes = []string{
+	"ipv4_address",                     // DO and SoftLayer and HetznerCloud
+	"public_ip",                        // AWS
+	"public_ipv6",                      // Scaleway
+	"ipaddress",                        // CS
+	"primary_ip",                       // Profitbricks, Cherry servers
+	"ip_address",                       // VMware, Docker, Linode
+	"private_ip",                       // AWS
+	"network_interface.0.ipv4_address", // VMware
+	"default_ip_address",               // provider.vsphere v1.1.1
+	"access_ip_v4",                     // OpenStack
+	"floating_ip",                      // OpenStack
+	"network_interface.0.access_config.0.nat_ip",          // GCE
+	"network_interface.0.access_config.0.assigned_nat_ip", // GCE
+	"network_interface.0.address",                         // GCE
+	"ipv4_address_private",                                // SoftLayer
+	"networks.0.ip4address",                               // Exoscale
+	"primaryip",                                           // Joyent Triton
+	"network_interface.0.addresses.0",                     // Libvirt
+	"network.0.address",                                   // Packet
+	"nic_list.0.ip_endpoint_list.0.ip",                    // Nutanix
+	"network_interface.0.nat_ip_address",                  // Yandex
+	"network_interface.0.ip_address",                      // Yandex
+	"default_ipv4_address",                                // Telmate/Proxmox
+	"ssh_host",                                            // Telmate/Proxmox
+}
+
+// providers is the registry used to look up the provider of a resource.
+var providers = newProviderRegistry(builtinProviders)
+
+type providerRegistry struct {
+	providers      []*Provider
+	byResourceType map[string]*Provider
+	ignored        map[string]bool
+}
+
+func newProviderRegistry(ps []*Provider) *providerRegistry {
+	pr := &providerRegistry{
+		byResourceType: make(map[string]*Provider),
+		ignored:        make(map[string]bool),
+	}
+	for _, p := range ps {
+		pr.register(p)
+	}
+	return pr
+}
+
+// register adds a provider to the registry. If a resource type has already been
+// registered by another provider, the new provider takes precedence.
+func (pr *providerRegistry) register(p *Provider) {
+	pr.providers = append(pr.providers, p)
+	for _, t := range p.ResourceTypes {
+		pr.byResourceType[t] = p
+		delete(pr.ignored, t)
+	}
+	for _, t := range p.IgnoredResourceTypes {
+		pr.ignored[t] = true
+	}
+}
+
+// hostnameAttributes returns the attributes which may hold the hostname of a
+// resource of the given type.
+func (pr *providerRegistry) hostnameAttributes(resourceType string) []string {
+	if p := pr.lookup(resourceType); p != nil {
+		return p.HostnameAttributes
+	}
+	return nil
+}
+
+// placementAttributes returns the placement attributes of a resource of the
+// given type.
+func (pr *providerRegistry) placementAttributes(resourceType string) []string {
+	if p := pr.lookup(resourceType); p != nil {
+		return p.PlacementAttributes
+	}
+	return nil
+}
+
+// lookup returns the provider of the given resource type, or nil if the type is
+// unknown.
+func (pr *providerRegistry) lookup(resourceType string) *Provider {
+	return pr.byResourceType[resourceType]
+}
+
+// addressAttributes returns the attributes which may hold the address of a
+// resource of the given type. Ignored resource types have none. Resource types
+// which don't belong to any known provider are checked against the fallback
+// address attributes, followed by the remaining address attributes of all
+// providers, so that similar resources (e.g. of forks of a provider) work out
+// of the box.
+func (pr *providerRegistry) addressAttributes(resourceType string) []string {
+	if pr.ignored[resourceType] {
+		return nil
+	}
+	if p := pr.lookup(resourceType); p != nil {
+		return p.AddressAttributes
+	}
+
+	attrs := append([]string{}, fallbackAddressAttributes...)
+	for _, p := range pr.providers {
+		for _, a := range p.AddressAttributes {
+			if !contains(attrs, a) {
+				attrs = append(attrs, a)
+			}
+		}
+	}
+	return attrs
+}
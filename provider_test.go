@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProviderRegistryAddressAttributes(t *testing.T) {
+	pr := newProviderRegistry([]*Provider{
+		{Name: "A", ResourceTypes: []string{"a_vm"}, AddressAttributes: []string{"public_ip", "private_ip"}},
+		{Name: "B", ResourceTypes: []string{"b_vm"}, AddressAttributes: []string{"ipv4_address", "private_ip", "lan_ip"}},
+	})
+
+	assert.Equal(t, []string{"public_ip", "private_ip"}, pr.addressAttributes("a_vm"))
+	assert.Equal(t, []string{"ipv4_address", "private_ip", "lan_ip"}, pr.addressAttributes("b_vm"))
+
+	// unknown types use the fallback order, then the other attributes
+	assert.Equal(t, append(append([]string{}, fallbackAddressAttributes...), "lan_ip"), pr.addressAttributes("c_vm"))
+}
+
+func TestProviderRegistryOverride(t *testing.T) {
+	pr := newProviderRegistry([]*Provider{
+		{Name: "A", ResourceTypes: []string{"a_vm", "a_container"}, AddressAttributes: []string{"public_ip"}},
+	})
+	pr.register(&Provider{Name: "A fork", ResourceTypes: []string{"a_vm"}, AddressAttributes: []string{"ip"}})
+
+	assert.Equal(t, "A fork", pr.lookup("a_vm").Name)
+	assert.Equal(t, "A", pr.lookup("a_container").Name)
+	assert.Nil(t, pr.lookup("b_vm"))
+}
+
+func TestResourceTagStyles(t *testing.T) {
+	r, err := NewResource("aws_instance.web", resourceState{
+		Type: "aws_instance",
+		Primary: instanceState{Attributes: map[string]string{
+			"public_ip":        "1.2.3.4",
+			"tags.%":           "2",
+			"tags.Role":        "Web",
+			"tags_all.Env":     "Prod",
+			"volume_tags.Skip": "me",
+		}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"role": "web", "env": "prod"}, r.Tags())
+
+	r, err = NewResource("linode_instance.web", resourceState{
+		Type: "linode_instance",
+		Primary: instanceState{Attributes: map[string]string{
+			"ip_address":   "1.2.3.4",
+			"tags_all.Env": "Prod",
+		}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"env": "prod"}, r.Tags())
+
+	r, err = NewResource("digitalocean_droplet.web", resourceState{
+		Type: "digitalocean_droplet",
+		Primary: instanceState{Attributes: map[string]string{
+			"ipv4_address": "1.2.3.4",
+			"tags.#":       "2",
+			"tags.0":       "Web",
+			"tags.1":       "staging",
+		}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"web": "", "staging": ""}, r.Tags())
+
+	r, err = NewResource("unknown_vm.web", resourceState{
+		Type: "unknown_vm",
+		Primary: instanceState{Attributes: map[string]string{
+			"ipv4_address": "1.2.3.4",
+			"tags.Role":    "web",
+		}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "1.2.3.4", r.Address())
+	assert.Equal(t, map[string]string{}, r.Tags())
+}
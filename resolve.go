@@ -0,0 +1,144 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// addressResolvers fill in the addresses of resources which get them from other
+// resources in the same state, e.g. Azure VMs from their network interfaces.
+// They are called with all resources of a state, and a map of the (lower-cased)
+// resource IDs to the resources.
+var addressResolvers = []func(resources []*Resource, byID map[string]*Resource){
+	resolveAzureAddresses,
+	resolveAWSElasticIPs,
+	resolveOpenStackFloatingIPs,
+}
+
+// resolveAddresses runs all address resolvers on the given resources. It must
+// be called with all resources of the state, not only the supported ones, as
+// neither the resources holding the addresses nor the resources without an
+// address of their own are supported.
+func resolveAddresses(resources []*Resource) {
+	byID := make(map[string]*Resource)
+	for _, r := range resources {
+		if r.State.Primary.ID != "" {
+			byID[strings.ToLower(r.State.Primary.ID)] = r
+		}
+	}
+
+	for _, resolve := range addressResolvers {
+		resolve(resources, byID)
+	}
+}
+
+// associateAddress attaches an address from another resource (e.g. an Elastic
+// IP) to a resource, as the given attribute. It takes precedence over the
+// addresses of the resource itself.
+func associateAddress(r *Resource, key string, ip string) {
+	if r == nil || ip == "" {
+		return
+	}
+	r.setAttribute(key, ip)
+	r.associatedAddress = ip
+}
+
+// resolveAzureAddresses takes the addresses of Azure VMs which don't expose them
+// (e.g. `azurerm_virtual_machine`) from the `azurerm_network_interface` and
+// `azurerm_public_ip` resources they reference.
+func resolveAzureAddresses(resources []*Resource, byID map[string]*Resource) {
+	for _, vm := range resources {
+		switch vm.resourceType {
+		case "azurerm_linux_virtual_machine", "azurerm_windows_virtual_machine", "azurerm_virtual_machine":
+		default:
+			continue
+		}
+
+		// The primary interface comes first, if it's known
+		var nicIDs []string
+		if id := vm.Attributes()["primary_network_interface_id"]; id != "" {
+			nicIDs = append(nicIDs, id)
+		}
+		nicIDs = append(nicIDs, vm.listAttribute("network_interface_ids")...)
+
+		for _, nicID := range nicIDs {
+			nic, exists := byID[strings.ToLower(nicID)]
+			if !exists || nic.resourceType != "azurerm_network_interface" {
+				continue
+			}
+
+			if vm.Attributes()["private_ip_address"] == "" {
+				if ip := nic.Attributes()["private_ip_address"]; ip != "" {
+					vm.setAttribute("private_ip_address", ip)
+				} else if ip := nic.Attributes()["ip_configuration.0.private_ip_address"]; ip != "" {
+					vm.setAttribute("private_ip_address", ip)
+				}
+			}
+
+			if vm.Attributes()["public_ip_address"] == "" {
+				n, _ := strconv.Atoi(nic.Attributes()["ip_configuration.#"])
+				for i := 0; i < n; i++ {
+					pipID := nic.Attributes()["ip_configuration."+strconv.Itoa(i)+".public_ip_address_id"]
+					pip, exists := byID[strings.ToLower(pipID)]
+					if exists && pip.resourceType == "azurerm_public_ip" && pip.Attributes()["ip_address"] != "" {
+						vm.setAttribute("public_ip_address", pip.Attributes()["ip_address"])
+						break
+					}
+				}
+			}
+		}
+	}
+}
+
+// resolveAWSElasticIPs attaches the addresses of Elastic IPs to the instances
+// they are associated with, either directly or through a network interface.
+func resolveAWSElasticIPs(resources []*Resource, byID map[string]*Resource) {
+	for _, r := range resources {
+		var ip, instanceID, eniID string
+
+		switch r.resourceType {
+		case "aws_eip":
+			ip = r.Attributes()["public_ip"]
+			instanceID = r.Attributes()["instance"]
+			eniID = r.Attributes()["network_interface"]
+		case "aws_eip_association":
+			ip = r.Attributes()["public_ip"]
+			if eip, exists := byID[strings.ToLower(r.Attributes()["allocation_id"])]; exists && ip == "" {
+				ip = eip.Attributes()["public_ip"]
+			}
+			instanceID = r.Attributes()["instance_id"]
+			eniID = r.Attributes()["network_interface_id"]
+		default:
+			continue
+		}
+
+		if instanceID == "" {
+			if eni, exists := byID[strings.ToLower(eniID)]; exists {
+				instanceID = eni.nestedAttribute("attachment", "instance")
+			}
+		}
+
+		associateAddress(byID[strings.ToLower(instanceID)], "public_ip", ip)
+	}
+}
+
+// resolveOpenStackFloatingIPs attaches the addresses of floating IPs to the
+// instances they are associated with, either directly or through a port.
+func resolveOpenStackFloatingIPs(resources []*Resource, byID map[string]*Resource) {
+	for _, r := range resources {
+		var instanceID string
+
+		switch r.resourceType {
+		case "openstack_compute_floatingip_associate_v2":
+			instanceID = r.Attributes()["instance_id"]
+		case "openstack_networking_floatingip_associate_v2":
+			if port, exists := byID[strings.ToLower(r.Attributes()["port_id"])]; exists {
+				instanceID = port.Attributes()["device_id"]
+			}
+		default:
+			continue
+		}
+
+		associateAddress(byID[strings.ToLower(instanceID)], "floating_ip", r.Attributes()["floating_ip"])
+	}
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const exampleStateFileAzure = `
+{
+	"version": 4,
+	"terraform_version": "1.5.7",
+	"resources": [
+		{
+			"mode": "managed",
+			"type": "azurerm_linux_virtual_machine",
+			"name": "web",
+			"instances": [
+				{
+					"attributes": {
+						"id": "/subscriptions/s/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/web",
+						"network_interface_ids": ["/subscriptions/s/resourceGroups/rg/providers/Microsoft.Network/networkInterfaces/web"],
+						"private_ip_address": "10.1.0.4",
+						"public_ip_address": "20.0.0.4",
+						"tags": {"Role": "web"}
+					}
+				}
+			]
+		},
+		{
+			"mode": "managed",
+			"type": "azurerm_virtual_machine",
+			"name": "legacy",
+			"instances": [
+				{
+					"attributes": {
+						"id": "/subscriptions/s/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/legacy",
+						"network_interface_ids": ["/subscriptions/s/resourceGroups/RG/providers/Microsoft.Network/networkInterfaces/legacy"],
+						"primary_network_interface_id": "",
+						"tags": {"Role": "legacy"}
+					}
+				}
+			]
+		},
+		{
+			"mode": "managed",
+			"type": "azurerm_windows_virtual_machine",
+			"name": "private",
+			"instances": [
+				{
+					"attributes": {
+						"id": "/subscriptions/s/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/private",
+						"network_interface_ids": ["/subscriptions/s/resourceGroups/rg/providers/Microsoft.Network/networkInterfaces/private"],
+						"private_ip_address": "",
+						"public_ip_address": ""
+					}
+				}
+			]
+		},
+		{
+			"mode": "managed",
+			"type": "azurerm_network_interface",
+			"name": "legacy",
+			"instances": [
+				{
+					"attributes": {
+						"id": "/subscriptions/s/resourceGroups/rg/providers/Microsoft.Network/networkInterfaces/legacy",
+						"private_ip_address": "10.1.0.5",
+						"ip_configuration": [
+							{
+								"name": "internal",
+								"primary": true,
+								"private_ip_address": "10.1.0.5",
+								"public_ip_address_id": "/subscriptions/s/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/legacy"
+							}
+						]
+					}
+				}
+			]
+		},
+		{
+			"mode": "managed",
+			"type": "azurerm_network_interface",
+			"name": "private",
+			"instances": [
+				{
+					"attributes": {
+						"id": "/subscriptions/s/resourceGroups/rg/providers/Microsoft.Network/networkInterfaces/private",
+						"ip_configuration": [
+							{
+								"name": "internal",
+								"private_ip_address": "10.1.0.6",
+								"public_ip_address_id": ""
+							}
+						]
+					}
+				}
+			]
+		},
+		{
+			"mode": "managed",
+			"type": "azurerm_public_ip",
+			"name": "legacy",
+			"instances": [
+				{
+					"attributes": {
+						"id": "/subscriptions/s/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/legacy",
+						"ip_address": "20.0.0.5"
+					}
+				}
+			]
+		}
+	]
+}
+`
+
+const expectedListOutputAzure = `
+{
+	"all": {
+		"hosts": ["10.1.0.6", "20.0.0.4", "20.0.0.5"],
+		"vars": {}
+	},
+	"web": {"hosts": ["20.0.0.4"], "children": ["web_0"]},
+	"web_0": ["20.0.0.4"],
+	"legacy": {"hosts": ["20.0.0.5"], "children": ["legacy_0"]},
+	"legacy_0": ["20.0.0.5"],
+	"private": {"hosts": ["10.1.0.6"], "children": ["private_0"]},
+	"private_0": ["10.1.0.6"],
+
+	"type_azurerm_linux_virtual_machine": ["20.0.0.4"],
+	"type_azurerm_virtual_machine": ["20.0.0.5"],
+	"type_azurerm_windows_virtual_machine": ["10.1.0.6"],
+
+	"role_web": ["20.0.0.4"],
+	"role_legacy": ["20.0.0.5"],
+
+	"role": {"children": ["role_legacy", "role_web"]},
+	"terraform_types": {"children": ["type_azurerm_linux_virtual_machine", "type_azurerm_virtual_machine", "type_azurerm_windows_virtual_machine"]}
+}
+`
+
+func TestListCommandAzure(t *testing.T) {
+	var s stateAnyTerraformVersion
+	r := strings.NewReader(exampleStateFileAzure)
+	err := s.read(r, &Encryption{})
+	assert.NoError(t, err)
+
+	// Decode expectation as JSON
+	var exp interface{}
+	err = json.Unmarshal([]byte(expectedListOutputAzure), &exp)
+	assert.NoError(t, err)
+
+	// Run the command, capture the output
+	var stdout, stderr bytes.Buffer
+	exitCode := cmdList(&stdout, &stderr, []*stateAnyTerraformVersion{&s}, &Config{})
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, "", stderr.String())
+
+	// Decode the output to compare
+	var act interface{}
+	err = json.Unmarshal([]byte(stdout.String()), &act)
+	assert.NoError(t, err)
+
+	assertHostvarsMatchHostCommand(t, &s, act)
+	assert.Equal(t, exp, act)
+}
+
+func TestResolveAzureAddresses(t *testing.T) {
+	var s stateAnyTerraformVersion
+	r := strings.NewReader(exampleStateFileAzure)
+	err := s.read(r, &Encryption{})
+	assert.NoError(t, err)
+
+	byName := map[string]*Resource{}
+	for _, res := range s.resources() {
+		byName[res.baseName] = res
+	}
+
+	// Addresses of the VM itself are kept
+	assert.Equal(t, "10.1.0.4", byName["web"].Attributes()["private_ip_address"])
+	assert.Equal(t, "20.0.0.4", byName["web"].Attributes()["public_ip_address"])
+
+	// Missing ones are taken from the network interface and public IP
+	assert.Equal(t, "10.1.0.5", byName["legacy"].Attributes()["private_ip_address"])
+	assert.Equal(t, "20.0.0.5", byName["legacy"].Attributes()["public_ip_address"])
+	assert.Equal(t, "20.0.0.5", byName["legacy"].Values()["public_ip_address"])
+
+	assert.Equal(t, "10.1.0.6", byName["private"].Attributes()["private_ip_address"])
+	assert.Equal(t, "", byName["private"].Attributes()["public_ip_address"])
+}
+
+const exampleStateFileAWSElasticIPs = `
+{
+	"version": 3,
+	"modules": [
+		{
+			"path": ["root"],
+			"resources": {
+				"aws_instance.direct": {
+					"type": "aws_instance",
+					"primary": {
+						"id": "i-11111111",
+						"attributes": {"id": "i-11111111", "private_ip": "10.0.0.1"}
+					}
+				},
+				"aws_eip.direct": {
+					"type": "aws_eip",
+					"primary": {
+						"id": "eipalloc-11111111",
+						"attributes": {"id": "eipalloc-11111111", "instance": "i-11111111", "public_ip": "52.0.0.1"}
+					}
+				},
+				"aws_instance.association": {
+					"type": "aws_instance",
+					"primary": {
+						"id": "i-22222222",
+						"attributes": {"id": "i-22222222", "private_ip": "10.0.0.2", "public_ip": "54.0.0.2"}
+					}
+				},
+				"aws_eip.association": {
+					"type": "aws_eip",
+					"primary": {
+						"id": "eipalloc-22222222",
+						"attributes": {"id": "eipalloc-22222222", "public_ip": "52.0.0.2"}
+					}
+				},
+				"aws_eip_association.association": {
+					"type": "aws_eip_association",
+					"primary": {
+						"id": "eipassoc-22222222",
+						"attributes": {"allocation_id": "eipalloc-22222222", "instance_id": "i-22222222"}
+					}
+				},
+				"aws_instance.eni": {
+					"type": "aws_instance",
+					"primary": {
+						"id": "i-33333333",
+						"attributes": {"id": "i-33333333", "private_ip": "10.0.0.3"}
+					}
+				},
+				"aws_network_interface.eni": {
+					"type": "aws_network_interface",
+					"primary": {
+						"id": "eni-33333333",
+						"attributes": {"attachment.#": "1", "attachment.2469923424.instance": "i-33333333", "private_ip": "10.0.0.33"}
+					}
+				},
+				"aws_eip.eni": {
+					"type": "aws_eip",
+					"primary": {
+						"id": "eipalloc-33333333",
+						"attributes": {"network_interface": "eni-33333333", "public_ip": "52.0.0.3"}
+					}
+				},
+				"aws_instance.none": {
+					"type": "aws_instance",
+					"primary": {
+						"id": "i-44444444",
+						"attributes": {"id": "i-44444444", "private_ip": "10.0.0.4"}
+					}
+				}
+			}
+		}
+	]
+}
+`
+
+func TestResolveAWSElasticIPs(t *testing.T) {
+	var s stateAnyTerraformVersion
+	r := strings.NewReader(exampleStateFileAWSElasticIPs)
+	err := s.read(r, &Encryption{})
+	assert.NoError(t, err)
+
+	addresses := map[string]string{}
+	for _, res := range s.resources() {
+		addresses[res.baseName] = res.Address()
+	}
+
+	// Elastic IPs, associations and network interfaces are not hosts
+	assert.Equal(t, map[string]string{
+		"direct":      "52.0.0.1",
+		"association": "52.0.0.2",
+		"eni":         "52.0.0.3",
+		"none":        "10.0.0.4",
+	}, addresses)
+
+	// the derived addresses are not written to the state itself
+	assert.NotContains(t, s.StatePre0dot12.Modules[0].ResourceStates["aws_instance.direct"].Primary.Attributes, "public_ip")
+	for _, res := range s.resources() {
+		if res.baseName == "direct" {
+			assert.Equal(t, "52.0.0.1", res.Attributes()["public_ip"])
+		}
+	}
+
+	// TF_KEY_NAME still has the last word
+	os.Setenv("TF_KEY_NAME", "private_ip")
+	defer os.Unsetenv("TF_KEY_NAME")
+	for _, res := range s.resources() {
+		if res.baseName == "association" {
+			assert.Equal(t, "10.0.0.2", res.Address())
+			assert.Equal(t, "52.0.0.2", res.Attributes()["public_ip"])
+		}
+	}
+}
+
+func TestAWSAddressResourcesAreNotHosts(t *testing.T) {
+	// unlike before addresses were resolved, Elastic IPs and network
+	// interfaces aren't hosts, even if they aren't attached to an instance
+	s := readTestState(t, `{
+		"version": 4,
+		"terraform_version": "1.5.7",
+		"resources": [
+			{"mode": "managed", "type": "aws_instance", "name": "web", "instances": [{"attributes": {"id": "i-1", "private_ip": "10.0.0.1"}}]},
+			{"mode": "managed", "type": "aws_eip", "name": "spare", "instances": [{"attributes": {"id": "eipalloc-1", "public_ip": "52.0.0.1"}}]},
+			{"mode": "managed", "type": "aws_network_interface", "name": "spare", "instances": [{"attributes": {"id": "eni-1", "private_ip": "10.0.0.9"}}]}
+		]
+	}`, "eip.tfstate", "")
+
+	groups, err := gatherInventory([]*stateAnyTerraformVersion{s}, &Config{}, &bytes.Buffer{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.1"}, groups["all"].(*allGroup).Hosts)
+	assert.NotContains(t, groups, "spare_0")
+	assert.NotContains(t, groups, "type_aws_eip")
+	assert.NotContains(t, groups, "type_aws_network_interface")
+}
+
+const exampleStateFileOpenStackFloatingIPs = `
+{
+	"version": 4,
+	"terraform_version": "1.5.7",
+	"resources": [
+		{
+			"mode": "managed",
+			"type": "openstack_compute_instance_v2",
+			"name": "compute",
+			"instances": [
+				{"attributes": {"id": "aaaa-1111", "access_ip_v4": "192.168.0.1"}}
+			]
+		},
+		{
+			"mode": "managed",
+			"type": "openstack_compute_floatingip_associate_v2",
+			"name": "compute",
+			"instances": [
+				{"attributes": {"id": "172.24.4.1/aaaa-1111/", "floating_ip": "172.24.4.1", "instance_id": "aaaa-1111"}}
+			]
+		},
+		{
+			"mode": "managed",
+			"type": "openstack_compute_instance_v2",
+			"name": "networking",
+			"instances": [
+				{"attributes": {"id": "bbbb-2222", "access_ip_v4": "192.168.0.2"}}
+			]
+		},
+		{
+			"mode": "managed",
+			"type": "openstack_networking_port_v2",
+			"name": "networking",
+			"instances": [
+				{"attributes": {"id": "port-2222", "device_id": "bbbb-2222"}}
+			]
+		},
+		{
+			"mode": "managed",
+			"type": "openstack_networking_floatingip_associate_v2",
+			"name": "networking",
+			"instances": [
+				{"attributes": {"id": "fip-2222", "floating_ip": "172.24.4.2", "port_id": "port-2222"}}
+			]
+		}
+	]
+}
+`
+
+func TestResolveOpenStackFloatingIPs(t *testing.T) {
+	var s stateAnyTerraformVersion
+	r := strings.NewReader(exampleStateFileOpenStackFloatingIPs)
+	err := s.read(r, &Encryption{})
+	assert.NoError(t, err)
+
+	addresses := map[string]string{}
+	for _, res := range s.resources() {
+		addresses[res.baseName] = res.Address()
+		assert.Equal(t, res.Address(), res.Attributes()["floating_ip"])
+	}
+
+	assert.Equal(t, map[string]string{
+		"compute":    "172.24.4.1",
+		"networking": "172.24.4.2",
+	}, addresses)
+}
@@ -4,44 +4,18 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 )
 
-// keyNames contains the names of the keys to check for in each resource in the
-// state file. This allows us to support multiple types of resource without too
-// much fuss.
-var keyNames []string
 var nameParser *regexp.Regexp
 
-func init() {
-	keyNames = []string{
-		"ipv4_address",                     // DO and SoftLayer and HetznerCloud
-		"public_ip",                        // AWS
-		"public_ipv6",                      // Scaleway
-		"ipaddress",                        // CS
-		"primary_ip",                                          // Profitbricks, Cherry servers
-		"ip_address",                       // VMware, Docker, Linode
-		"private_ip",                       // AWS
-		"network_interface.0.ipv4_address", // VMware
-		"default_ip_address",               // provider.vsphere v1.1.1
-		"access_ip_v4",                     // OpenStack
-		"floating_ip",                      // OpenStack
-		"network_interface.0.access_config.0.nat_ip",          // GCE
-		"network_interface.0.access_config.0.assigned_nat_ip", // GCE
-		"network_interface.0.address",                         // GCE
-		"ipv4_address_private",                                // SoftLayer
-		"networks.0.ip4address",                               // Exoscale
-		"primaryip",                                           // Joyent Triton
-		"network_interface.0.addresses.0",                     // Libvirt
-		"network.0.address",                                   // Packet
-		"nic_list.0.ip_endpoint_list.0.ip",                    // Nutanix
-		"network_interface.0.nat_ip_address",                  // Yandex
-		"network_interface.0.ip_address",                      // Yandex
-		"default_ipv4_address",                                // Telmate/Proxmox
-		"ssh_host",                                            // Telmate/Proxmox
-	}
+// moduleParser matches the modules of a module address, e.g. `module.a` and
+// `module.b["x"]` in `module.a.module.b["x"]`.
+var moduleParser = regexp.MustCompile(`module\.([^.\[]+)(?:\[([^\]]*)\])?`)
 
+func init() {
 	// Formats:
 	// - type.[module_]name (no `count` attribute; contains module name if we're not in the root module)
 	// - type.[module_]name.0 (if resource has `count` attribute)
@@ -64,6 +38,21 @@ type Resource struct {
 	resourceType string
 	baseName     string
 
+	// The Terraform address of the resource, e.g. `module.db.aws_instance.host[0]`,
+	// and of the module containing it, e.g. `module.db` (empty for the root
+	// module). Set by the state parsers.
+	address       string
+	moduleAddress string
+
+	// An address associated with the resource through another resource, e.g.
+	// an Elastic IP. Set by the address resolvers.
+	associatedAddress string
+
+	// Attributes which are not taken from the state, but derived from other
+	// resources by the address resolvers. They are kept apart from the state,
+	// which may be read again.
+	derivedAttributes map[string]string
+
 	// counterNumeric is 0 for resources created without `count=` attribute or
 	// having a non-numeric string index
 	counterNumeric int
@@ -111,141 +100,218 @@ func (r Resource) IsSupported() bool {
 
 // Tags returns a map of arbitrary key/value pairs explicitly associated with
 // the resource. Different providers have different mechanisms for attaching
-// these.
+// these, see Provider.
 func (r Resource) Tags() map[string]string {
 	t := map[string]string{}
 
-	switch r.resourceType {
-	case "openstack_compute_instance_v2":
-		for k, v := range r.Attributes() {
-			parts := strings.SplitN(k, ".", 2)
-			// At some point Terraform changed the key for counts of attributes to end with ".%"
-			// instead of ".#". Both need to be considered as Terraform still supports state
-			// files using the old format.
-			if len(parts) == 2 && parts[0] == "tag" && parts[1] != "#" && parts[1] != "%" {
-				kk := strings.ToLower(parts[1])
-				vv := strings.ToLower(v)
-				t[kk] = vv
-			} else if len(parts) == 2 && parts[0] == "metadata" && parts[1] != "#" && parts[1] != "%" {
-				kk := strings.ToLower(parts[1])
-				vv := strings.ToLower(v)
-				t[kk] = vv
-			}
-		}
-	case "opentelekomcloud_compute_instance_v2":
-		for k, v := range r.Attributes() {
-			parts := strings.SplitN(k, ".", 2)
-			// At some point Terraform changed the key for counts of attributes to end with ".%"
-			// instead of ".#". Both need to be considered as Terraform still supports state
-			// files using the old format.
-			if len(parts) == 2 && parts[0] == "tag" && parts[1] != "#" && parts[1] != "%" {
-				kk := strings.ToLower(parts[1])
-				vv := strings.ToLower(v)
-				t[kk] = vv
-			} else if len(parts) == 2 && parts[0] == "metadata" && parts[1] != "#" && parts[1] != "%" {
-				kk := strings.ToLower(parts[1])
-				vv := strings.ToLower(v)
-				t[kk] = vv
-			}
+	p := providers.lookup(r.resourceType)
+	if p == nil {
+		return t
+	}
+
+	for k, v := range r.Attributes() {
+		parts := strings.SplitN(k, ".", 2)
+		// At some point Terraform changed the key for counts of attributes to end with ".%"
+		// instead of ".#". Both need to be considered as Terraform still supports state
+		// files using the old format.
+		if len(parts) != 2 || parts[1] == "#" || parts[1] == "%" || !contains(p.TagAttributes, parts[0]) {
+			continue
 		}
-	case "aws_instance", "linode_instance":
-		for k, v := range r.Attributes() {
-			parts := strings.SplitN(k, ".", 2)
-			// At some point Terraform changed the key for counts of attributes to end with ".%"
-			// instead of ".#". Both need to be considered as Terraform still supports state
-			// files using the old format.
-			if len(parts) == 2 && (parts[0] == "tags" || parts[0] == "tags_all") && parts[1] != "#" && parts[1] != "%" {
-				kk := strings.ToLower(parts[1])
-				vv := strings.ToLower(v)
-				t[kk] = vv
-			}
+
+		switch p.TagStyle {
+		case TagStyleValue:
+			t[strings.ToLower(v)] = ""
+		default:
+			t[strings.ToLower(parts[1])] = strings.ToLower(v)
 		}
-	case "aws_spot_instance_request":
-		for k, v := range r.Attributes() {
-			parts := strings.SplitN(k, ".", 2)
-			// At some point Terraform changed the key for counts of attributes to end with ".%"
-			// instead of ".#". Both need to be considered as Terraform still supports state
-			// files using the old format.
-			if len(parts) == 2 && (parts[0] == "tags" || parts[0] == "tags_all") && parts[1] != "#" && parts[1] != "%" {
-				kk := strings.ToLower(parts[1])
-				vv := strings.ToLower(v)
-				t[kk] = vv
+	}
+
+	return t
+}
+
+// tagValue returns the value of the given tag as it is in the state, i.e. not
+// lower-cased like by Tags, or an empty string. Like with Tags, the key is
+// matched case-insensitively; if several keys match, the first in sort order
+// wins.
+func (r Resource) tagValue(key string) string {
+	p := providers.lookup(r.resourceType)
+	if p == nil || p.TagStyle == TagStyleValue {
+		return ""
+	}
+
+	attributes := r.Attributes()
+	keys := []string{}
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		parts := strings.SplitN(k, ".", 2)
+		if len(parts) == 2 && contains(p.TagAttributes, parts[0]) && strings.EqualFold(parts[1], key) {
+			if v := attributes[k]; v != "" {
+				return v
 			}
 		}
-	case "vsphere_virtual_machine":
-		for k, v := range r.Attributes() {
-			parts := strings.SplitN(k, ".", 2)
-
-			if len(parts) == 2 && parts[0] == "custom_configuration_parameters" && parts[1] != "#" && parts[1] != "%" {
-				kk := strings.ToLower(parts[1])
-				vv := strings.ToLower(v)
-				t[kk] = vv
-			}
-			if len(parts) == 2 && parts[0] == "tags" && parts[1] != "#" && parts[1] != "%" {
-				kk := strings.ToLower(parts[1])
-				vv := strings.ToLower(v)
-				t[kk] = vv
-			}
+	}
+
+	return ""
+}
+
+// Attributes returns a map containing everything we know about this resource.
+func (r Resource) Attributes() map[string]string {
+	if len(r.derivedAttributes) == 0 {
+		return r.State.Primary.Attributes
+	}
+
+	attributes := make(map[string]string, len(r.State.Primary.Attributes)+len(r.derivedAttributes))
+	for k, v := range r.State.Primary.Attributes {
+		attributes[k] = v
+	}
+	for k, v := range r.derivedAttributes {
+		attributes[k] = v
+	}
+	return attributes
+}
+
+// attribute returns the value of a single attribute, see Attributes.
+func (r Resource) attribute(key string) string {
+	if v, exists := r.derivedAttributes[key]; exists {
+		return v
+	}
+	return r.State.Primary.Attributes[key]
+}
+
+// listAttribute returns the values of a (flattened) list of strings, e.g. of
+// `network_interface_ids.0`, `network_interface_ids.1` etc. for the name
+// `network_interface_ids`.
+func (r Resource) listAttribute(name string) []string {
+	n, _ := strconv.Atoi(r.State.Primary.Attributes[name+".#"])
+	values := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		if v := r.State.Primary.Attributes[name+"."+strconv.Itoa(i)]; v != "" {
+			values = append(values, v)
 		}
-	case "digitalocean_droplet", "google_compute_instance", "scaleway_server":
-		for k, v := range r.Attributes() {
-			parts := strings.SplitN(k, ".", 2)
-			if len(parts) == 2 && parts[0] == "tags" && parts[1] != "#" {
-				vv := strings.ToLower(v)
-				t[vv] = ""
-			}
+	}
+	return values
+}
+
+// nestedAttribute returns a non-empty value of the given attribute of the
+// elements of a (flattened) list or set of blocks, e.g. of
+// `attachment.0.instance` for the block `attachment` and the attribute
+// `instance`. It's meant for blocks which usually have a single element. Sets
+// in pre-0.12 state use hashes instead of indices.
+func (r Resource) nestedAttribute(block string, name string) string {
+	for k, v := range r.State.Primary.Attributes {
+		if v != "" && strings.HasPrefix(k, block+".") && strings.HasSuffix(k, "."+name) && strings.Count(k, ".") == 2 {
+			return v
 		}
-	case "triton_machine", "exoscale_compute":
-		for k, v := range r.Attributes() {
-			parts := strings.SplitN(k, ".", 2)
-			if len(parts) == 2 && parts[0] == "tags" && parts[1] != "%" {
-				kk := strings.ToLower(parts[1])
-				vv := strings.ToLower(v)
-				t[kk] = vv
-			}
+	}
+	return ""
+}
+
+// setAttribute sets an attribute which was not taken from the state, but
+// derived from other resources, e.g. the address of an associated IP.
+func (r *Resource) setAttribute(key string, value string) {
+	if r.derivedAttributes == nil {
+		r.derivedAttributes = make(map[string]string)
+	}
+	r.derivedAttributes[key] = value
+}
+
+// Values returns everything we know about this resource like Attributes, but
+// with the original types and nesting of the values. Pre-0.12 state files only
+// contain flat strings, so the attributes are returned as they are for those.
+func (r Resource) Values() map[string]interface{} {
+	if r.State.Primary.RawValues != nil && len(r.derivedAttributes) == 0 {
+		return r.State.Primary.RawValues
+	}
+
+	values := make(map[string]interface{}, len(r.State.Primary.Attributes)+len(r.derivedAttributes))
+	if r.State.Primary.RawValues != nil {
+		for k, v := range r.State.Primary.RawValues {
+			values[k] = v
 		}
-	case "yandex_compute_instance", "hcloud_server":
-		for k, v := range r.Attributes() {
-			parts := strings.SplitN(k, ".", 2)
-			// At some point Terraform changed the key for counts of attributes to end with ".%"
-			// instead of ".#". Both need to be considered as Terraform still supports state
-			// files using the old format.
-			if len(parts) == 2 && parts[0] == "labels" && parts[1] != "#" && parts[1] != "%" {
-				kk := strings.ToLower(parts[1])
-				vv := strings.ToLower(v)
-				t[kk] = vv
-			}
+		for k, v := range r.derivedAttributes {
+			values[k] = v
 		}
+		return values
 	}
 
-	return t
+	for k, v := range r.Attributes() {
+		values[k] = v
+	}
+	return values
 }
 
-// Attributes returns a map containing everything we know about this resource.
-func (r Resource) Attributes() map[string]string {
-	return r.State.Primary.Attributes
+// individualName returns the name of the group of this resource alone, i.e.
+// `<name>_<count>`.
+func (r Resource) individualName() string {
+	if r.counterStr != "" {
+		return fmt.Sprintf("%s_%s", r.baseName, strings.Replace(r.counterStr, ".", "_", -1))
+	}
+	return fmt.Sprintf("%s_%d", r.baseName, r.counterNumeric)
+}
+
+// moduleGroups returns the names of the groups of the modules in the module
+// path of this resource, e.g. `module_a` and `module_a_module_db` for
+// `module.a.module.db`. Instances of modules with `count` or `for_each` are in
+// a group of the module and one of the instance, e.g. `module_a` and
+// `module_a_0` for `module.a[0]`.
+func (r Resource) moduleGroups() []string {
+	return moduleNames(r.moduleAddress)
+}
+
+// moduleNames returns the names of the modules in the given module path, see
+// moduleGroups. The last one names the module itself.
+func moduleNames(moduleAddress string) []string {
+	var groups []string
+
+	prefix := ""
+	for _, m := range moduleParser.FindAllStringSubmatch(moduleAddress, -1) {
+		name := prefix + "module_" + m[1]
+		groups = append(groups, name)
+
+		if m[2] != "" {
+			key := strings.Trim(m[2], `"`)
+			name += "_" + strings.Replace(key, ".", "_", -1)
+			groups = append(groups, name)
+		}
+		prefix = name + "_"
+	}
+
+	return groups
 }
 
 // Hostname returns the hostname of this resource.
 func (r Resource) Hostname() string {
 	if keyName := os.Getenv("TF_HOSTNAME_KEY_NAME"); keyName != "" {
-		if ip := r.State.Primary.Attributes[keyName]; ip != "" {
+		if ip := r.attribute(keyName); ip != "" {
 			return ip
 		}
 	}
 
+	for _, key := range providers.hostnameAttributes(r.resourceType) {
+		if name := r.attribute(key); name != "" {
+			return name
+		}
+	}
+
 	return r.Address()
 }
 
 // Address returns the IP address of this resource.
 func (r Resource) Address() string {
 	if keyName := os.Getenv("TF_KEY_NAME"); keyName != "" {
-		if ip := r.State.Primary.Attributes[keyName]; ip != "" {
+		if ip := r.attribute(keyName); ip != "" {
 			return ip
 		}
 	} else {
-		for _, key := range keyNames {
-			if ip := r.State.Primary.Attributes[key]; ip != "" {
+		if r.associatedAddress != "" {
+			return r.associatedAddress
+		}
+		for _, key := range providers.addressAttributes(r.resourceType) {
+			if ip := r.attribute(key); ip != "" {
 				return ip
 			}
 		}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/adammck/venv"
+	"github.com/blang/vfs"
+)
+
+// s3Backend reads states from an S3 (or S3-compatible) bucket, laid out like
+// Terraform's `s3` backend does. It's given as `s3://<bucket>/<key>`, with the
+// optional parameters `region`, `endpoint`, `workspace_key_prefix`, `profile`
+// and `use_path_style`.
+type s3Backend struct {
+	bucket             string
+	key                string
+	workspaceKeyPrefix string
+	region             string
+	endpoint           *url.URL
+	usePathStyle       bool
+	credentials        awsCredentials
+}
+
+func newS3Backend(u *url.URL, fs vfs.Filesystem, env venv.Env) (backend, error) {
+	params := u.Query()
+
+	b := &s3Backend{
+		bucket:             u.Host,
+		key:                strings.TrimPrefix(u.Path, "/"),
+		workspaceKeyPrefix: "env:",
+		region:             params.Get("region"),
+		usePathStyle:       params.Get("use_path_style") == "true",
+	}
+	if b.bucket == "" || b.key == "" {
+		return nil, fmt.Errorf("Invalid S3 URL %s, expected s3://<bucket>/<key>", backendSource(u))
+	}
+	if _, exists := params["workspace_key_prefix"]; exists {
+		b.workspaceKeyPrefix = params.Get("workspace_key_prefix")
+	}
+
+	conf := newAWSConfig(fs, env, params.Get("profile"))
+	b.credentials = conf.credentials()
+	if b.region == "" {
+		b.region = conf.region()
+	}
+	if b.region == "" {
+		b.region = "us-east-1"
+	}
+
+	endpoint := params.Get("endpoint")
+	for _, key := range []string{"AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"} {
+		if endpoint == "" {
+			endpoint = env.Getenv(key)
+		}
+	}
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", b.region)
+	}
+
+	var err error
+	b.endpoint, err = url.Parse(endpoint)
+	if err != nil || b.endpoint.Host == "" {
+		return nil, fmt.Errorf("Invalid S3 endpoint %q", endpoint)
+	}
+
+	return b, nil
+}
+
+// objectKey returns the key of the state of the given workspace.
+func (b *s3Backend) objectKey(workspace string) string {
+	if workspace == "" || workspace == "default" {
+		return b.key
+	}
+	return path.Join(b.workspaceKeyPrefix, workspace, b.key)
+}
+
+// request sends a signed GET request for the given key (empty for the bucket
+// itself) and returns the body of a successful response.
+func (b *s3Backend) request(key string, query url.Values) ([]byte, error) {
+	u := *b.endpoint
+	objectPath := "/" + key
+	if b.usePathStyle {
+		objectPath = "/" + b.bucket + objectPath
+	} else {
+		u.Host = b.bucket + "." + u.Host
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + objectPath
+	u.RawPath = awsURIEncode(u.Path, false)
+	u.RawQuery = awsCanonicalQuery(query)
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	signAWSRequest(req, b.credentials, b.region, "s3", time.Now())
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET s3://%s/%s returned %s: %s", b.bucket, key, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return body, nil
+}
+
+func (b *s3Backend) state(workspace string) (io.Reader, error) {
+	body, err := b.request(b.objectKey(workspace), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.NewReader(body), nil
+}
+
+// workspaces lists the default workspace and the workspaces which have a state
+// under the workspace key prefix, like Terraform does.
+func (b *s3Backend) workspaces() ([]string, error) {
+	workspaces := []string{"default"}
+
+	prefix := b.workspaceKeyPrefix + "/"
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+	for {
+		body, err := b.request("", query)
+		if err != nil {
+			return nil, err
+		}
+
+		var result struct {
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		err = xml.Unmarshal(body, &result)
+		if err != nil {
+			return nil, fmt.Errorf("Error listing s3://%s/%s: %s", b.bucket, prefix, err)
+		}
+
+		// Keys look like `<prefix>/<workspace>/<key>`
+		for _, obj := range result.Contents {
+			parts := strings.SplitN(strings.TrimPrefix(obj.Key, prefix), "/", 2)
+			if len(parts) == 2 && parts[0] != "" && parts[1] == b.key {
+				workspaces = append(workspaces, parts[0])
+			}
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+
+	return workspaces, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/adammck/venv"
+	"github.com/blang/vfs/memfs"
+	"github.com/stretchr/testify/assert"
+)
+
+// s3Stub is a minimal S3-compatible server (path-style, like MinIO), which
+// serves the given objects of the bucket `tfstate`.
+func s3Stub(t *testing.T, objects map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") || !strings.Contains(auth, "/eu-central-1/s3/aws4_request") {
+			http.Error(w, "AccessDenied", http.StatusForbidden)
+			return
+		}
+		assert.Equal(t, "session", r.Header.Get("X-Amz-Security-Token"))
+
+		if r.URL.Path == "/tfstate/" && r.URL.Query().Get("list-type") == "2" {
+			prefix := r.URL.Query().Get("prefix")
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><ListBucketResult>`)
+			for key := range objects {
+				if strings.HasPrefix(key, prefix) {
+					fmt.Fprintf(w, "<Contents><Key>%s</Key></Contents>", key)
+				}
+			}
+			fmt.Fprint(w, `<IsTruncated>false</IsTruncated></ListBucketResult>`)
+			return
+		}
+
+		// The raw path must be encoded like in the signature
+		key := strings.TrimPrefix(r.URL.EscapedPath(), "/tfstate/")
+		if strings.Contains(key, ":") {
+			http.Error(w, "SignatureDoesNotMatch", http.StatusForbidden)
+			return
+		}
+		key, _ = url.PathUnescape(key)
+
+		if body, exists := objects[key]; exists {
+			fmt.Fprint(w, body)
+			return
+		}
+		http.Error(w, "NoSuchKey", http.StatusNotFound)
+	}))
+}
+
+func s3Env() venv.Env {
+	env := venv.Mock()
+	env.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	env.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	env.Setenv("AWS_SESSION_TOKEN", "session")
+	return env
+}
+
+func TestS3Backend(t *testing.T) {
+	server := s3Stub(t, map[string]string{
+		"infra/terraform.tfstate":              exampleStateFileTerraformV4,
+		"env:/staging/infra/terraform.tfstate": exampleStateFileAzure,
+		"env:/staging/other.tfstate":           "{}",
+	})
+	defer server.Close()
+
+	source := "s3://tfstate/infra/terraform.tfstate?region=eu-central-1&use_path_style=true&endpoint=" + url.QueryEscape(server.URL)
+	states, err := readStates(memfs.Create(), s3Env(), &Terraform{}, &Encryption{}, source, "")
+	assert.NoError(t, err)
+	assert.Len(t, states, 1)
+	assert.Equal(t, "s3://tfstate/infra/terraform.tfstate", states[0].Source)
+	assert.Len(t, states[0].resources(), 5)
+
+	states, err = readStates(memfs.Create(), s3Env(), &Terraform{}, &Encryption{}, source, allWorkspaces)
+	assert.NoError(t, err)
+	assert.Len(t, states, 2)
+	assert.Equal(t, "default", states[0].Name)
+	assert.Equal(t, "staging", states[1].Name)
+	assert.Equal(t, "s3://tfstate/infra/terraform.tfstate (workspace staging)", states[1].Source)
+	assert.Len(t, states[1].resources(), 3)
+
+	// Missing states and wrong credentials are errors
+	_, err = readStates(memfs.Create(), s3Env(), &Terraform{}, &Encryption{}, source, "prod")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "404")
+
+	_, err = readStates(memfs.Create(), s3Env(), &Terraform{}, &Encryption{}, strings.Replace(source, "eu-central-1", "us-east-1", 1), "")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "AccessDenied")
+}
+
+func TestS3BackendURLs(t *testing.T) {
+	env := s3Env()
+	env.Setenv("AWS_REGION", "eu-west-1")
+
+	u, _ := url.Parse("s3://tfstate/a/b.tfstate")
+	b, err := newS3Backend(u, memfs.Create(), env)
+	assert.NoError(t, err)
+	s3 := b.(*s3Backend)
+	assert.Equal(t, "eu-west-1", s3.region)
+	assert.Equal(t, "https://s3.eu-west-1.amazonaws.com", s3.endpoint.String())
+	assert.False(t, s3.usePathStyle)
+	assert.Equal(t, "a/b.tfstate", s3.objectKey("default"))
+	assert.Equal(t, "env:/prod/a/b.tfstate", s3.objectKey("prod"))
+
+	u, _ = url.Parse("s3://tfstate/b.tfstate?workspace_key_prefix=workspaces")
+	b, err = newS3Backend(u, memfs.Create(), env)
+	assert.NoError(t, err)
+	assert.Equal(t, "workspaces/prod/b.tfstate", b.(*s3Backend).objectKey("prod"))
+
+	for _, source := range []string{"s3://tfstate", "s3:///key", "s3://tfstate/key?endpoint=nohost"} {
+		u, _ = url.Parse(source)
+		_, err = newS3Backend(u, memfs.Create(), env)
+		assert.Error(t, err, source)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// SSH holds the settings of the `ssh` output format, which writes a `Host`
+// block of an OpenSSH client config for every host.
+type SSH struct {
+
+	// Where to take the user from, by default the tag `ssh_user`.
+	User SSHOption `yaml:"user"`
+
+	// Where to take the port from, by default the tag `ssh_port`.
+	Port SSHOption `yaml:"port"`
+
+	// Where to take the jump host from, by default the tag `ssh_proxy_jump`.
+	ProxyJump SSHOption `yaml:"proxy_jump"`
+}
+
+// SSHOption tells where to take the value of an SSH option from: the first of
+// the given attributes and tags which is set, or else the default. If neither
+// attributes nor tags are given, a tag named after the option is used.
+type SSHOption struct {
+
+	// (Flattened) attributes, in order of priority, e.g. `tags.User`
+	Attributes []string `yaml:"attributes"`
+
+	// Tags, in order of priority, e.g. `ssh_user`
+	Tags []string `yaml:"tags"`
+
+	// Value for hosts which have none of the attributes and tags
+	Default string `yaml:"default"`
+}
+
+// value returns the value of the option for the given resource, or an empty
+// string.
+func (o *SSHOption) value(res *Resource, defaultTag string) string {
+	tagNames := o.Tags
+	if len(o.Attributes) == 0 && len(o.Tags) == 0 {
+		tagNames = []string{defaultTag}
+	}
+
+	attributes := res.Attributes()
+	for _, key := range o.Attributes {
+		if v := attributes[key]; v != "" {
+			return v
+		}
+	}
+
+	for _, key := range tagNames {
+		if v := res.tagValue(key); v != "" {
+			return v
+		}
+	}
+
+	return o.Default
+}
+
+// sshHost is a `Host` block of the SSH config.
+type sshHost struct {
+	aliases []string
+	options [][2]string
+}
+
+// sshHosts returns the `Host` blocks for the resources of the given states,
+// sorted by their first alias. Hosts are aliased by their individual group name
+// (e.g. `web_0`) and their hostname. Aliases which are taken by several hosts
+// are reported to stderr, and the first host wins.
+func sshHosts(states []*stateAnyTerraformVersion, conf *Config, stderr io.Writer) []*sshHost {
+	var hosts []*sshHost
+	taken := make(map[string]bool)
+
+	for _, s := range states {
+		for _, res := range s.resources() {
+			host := &sshHost{}
+			for _, alias := range []string{res.individualName(), res.Hostname()} {
+				if strings.Contains(alias, `"`) {
+					fmt.Fprintf(stderr, "state %s not writing SSH host alias %s of %s, it contains a double quote\n", s.Source, alias, res.Address())
+					continue
+				}
+				if taken[alias] {
+					if !contains(host.aliases, alias) {
+						fmt.Fprintf(stderr, "state %s not overwriting already existing SSH host %s with %s\n", s.Source, alias, res.Address())
+					}
+					continue
+				}
+				taken[alias] = true
+				host.aliases = append(host.aliases, alias)
+			}
+			if len(host.aliases) == 0 {
+				continue
+			}
+
+			options := [][2]string{{"HostName", res.Address()}}
+			for _, opt := range []struct {
+				name       string
+				option     *SSHOption
+				defaultTag string
+			}{
+				{"User", &conf.SSH.User, "ssh_user"},
+				{"Port", &conf.SSH.Port, "ssh_port"},
+				{"ProxyJump", &conf.SSH.ProxyJump, "ssh_proxy_jump"},
+			} {
+				if v := opt.option.value(res, opt.defaultTag); v != "" {
+					options = append(options, [2]string{opt.name, v})
+				}
+			}
+			for _, opt := range options {
+				// the SSH config has no way to escape double quotes
+				if strings.Contains(opt[1], `"`) {
+					fmt.Fprintf(stderr, "state %s not writing %s %s of SSH host %s, it contains a double quote\n", s.Source, opt[0], opt[1], host.aliases[0])
+					continue
+				}
+				host.options = append(host.options, opt)
+			}
+
+			hosts = append(hosts, host)
+		}
+	}
+
+	sort.Slice(hosts, func(i, j int) bool {
+		return hosts[i].aliases[0] < hosts[j].aliases[0]
+	})
+
+	return hosts
+}
+
+// sshQuote quotes a value of the SSH config if it contains whitespace. Values
+// containing double quotes can't be written, see sshHosts.
+func sshQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t") {
+		return s
+	}
+	return `"` + s + `"`
+}
+
+func cmdSSH(stdout io.Writer, stderr io.Writer, states []*stateAnyTerraformVersion, conf *Config) int {
+	var b strings.Builder
+	for i, host := range sshHosts(states, conf, stderr) {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+
+		aliases := make([]string, len(host.aliases))
+		for i, alias := range host.aliases {
+			aliases[i] = sshQuote(alias)
+		}
+		b.WriteString("Host " + strings.Join(aliases, " ") + "\n")
+
+		for _, opt := range host.options {
+			b.WriteString("    " + opt[0] + " " + sshQuote(opt[1]) + "\n")
+		}
+	}
+
+	_, err := io.WriteString(stdout, b.String())
+	return checkErr(err, stderr)
+}
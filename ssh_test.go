@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const exampleStateFileSSH = `
+{
+	"version": 4,
+	"terraform_version": "1.5.7",
+	"resources": [
+		{
+			"mode": "managed",
+			"type": "aws_instance",
+			"name": "web",
+			"instances": [
+				{
+					"index_key": 0,
+					"attributes": {
+						"id": "i-0",
+						"private_ip": "10.0.0.10",
+						"tags": {
+							"ssh_user": "ubuntu",
+							"ssh_proxy_jump": "bastion.example.com"
+						}
+					}
+				},
+				{
+					"index_key": 1,
+					"attributes": {
+						"id": "i-1",
+						"private_ip": "10.0.0.11",
+						"tags": {
+							"ssh_user": "ubuntu",
+							"ssh_port": "2222"
+						}
+					}
+				}
+			]
+		},
+		{
+			"mode": "managed",
+			"type": "aws_instance",
+			"name": "db",
+			"instances": [
+				{
+					"attributes": {
+						"id": "i-2",
+						"private_ip": "10.0.0.20",
+						"ami": "ami-debian",
+						"tags": {
+							"Login": "admin"
+						}
+					}
+				}
+			]
+		}
+	]
+}
+`
+
+func TestSSHCommand(t *testing.T) {
+	s := readTestState(t, exampleStateFileSSH, "ssh.tfstate", "")
+
+	var stdout, stderr bytes.Buffer
+	exitCode := cmdSSH(&stdout, &stderr, []*stateAnyTerraformVersion{s}, &Config{})
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, "", stderr.String())
+	assert.Equal(t, `Host db_0 10.0.0.20
+    HostName 10.0.0.20
+
+Host web_0 10.0.0.10
+    HostName 10.0.0.10
+    User ubuntu
+    ProxyJump bastion.example.com
+
+Host web_1 10.0.0.11
+    HostName 10.0.0.11
+    User ubuntu
+    Port 2222
+`, stdout.String())
+}
+
+func TestSSHCommandWithConfig(t *testing.T) {
+	s := readTestState(t, exampleStateFileSSH, "ssh.tfstate", "")
+	conf := &Config{SSH: SSH{
+		User:      SSHOption{Attributes: []string{"tags.User"}, Tags: []string{"login", "ssh_user"}, Default: "root"},
+		ProxyJump: SSHOption{Default: "jump host"},
+	}}
+
+	var stdout, stderr bytes.Buffer
+	exitCode := cmdSSH(&stdout, &stderr, []*stateAnyTerraformVersion{s}, conf)
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, "", stderr.String())
+	assert.Equal(t, `Host db_0 10.0.0.20
+    HostName 10.0.0.20
+    User admin
+    ProxyJump "jump host"
+
+Host web_0 10.0.0.10
+    HostName 10.0.0.10
+    User ubuntu
+    ProxyJump bastion.example.com
+
+Host web_1 10.0.0.11
+    HostName 10.0.0.11
+    User ubuntu
+    Port 2222
+    ProxyJump "jump host"
+`, stdout.String())
+}
+
+func TestSSHCommandCollisions(t *testing.T) {
+	s := readTestState(t, exampleStateFileSSH, "ssh.tfstate", "")
+
+	var single, stdout, stderr bytes.Buffer
+	cmdSSH(&single, &stderr, []*stateAnyTerraformVersion{s}, &Config{})
+	exitCode := cmdSSH(&stdout, &stderr, []*stateAnyTerraformVersion{s, s}, &Config{})
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, single.String(), stdout.String())
+	assert.Contains(t, stderr.String(), "state ssh.tfstate not overwriting already existing SSH host web_0 with 10.0.0.10\n")
+	assert.Contains(t, stderr.String(), "state ssh.tfstate not overwriting already existing SSH host 10.0.0.10 with 10.0.0.10\n")
+}
+
+func TestSSHCommandTagValues(t *testing.T) {
+	// tag keys are matched case-insensitively, but the values are kept as they are
+	state := strings.Replace(exampleStateFileSSH, `"ssh_proxy_jump": "bastion.example.com"`, `"SSH_Proxy_Jump": "Bastion.Example.com"`, 1)
+	state = strings.Replace(state, `"ssh_port": "2222"`, `"ssh_port": "22\"22"`, 1)
+	s := readTestState(t, state, "ssh.tfstate", "")
+
+	var stdout, stderr bytes.Buffer
+	exitCode := cmdSSH(&stdout, &stderr, []*stateAnyTerraformVersion{s}, &Config{})
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, "state ssh.tfstate not writing Port 22\"22 of SSH host web_1, it contains a double quote\n", stderr.String())
+	assert.Equal(t, `Host db_0 10.0.0.20
+    HostName 10.0.0.20
+
+Host web_0 10.0.0.10
+    HostName 10.0.0.10
+    User ubuntu
+    ProxyJump Bastion.Example.com
+
+Host web_1 10.0.0.11
+    HostName 10.0.0.11
+    User ubuntu
+`, stdout.String())
+}
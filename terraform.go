@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// allWorkspaces is the workspace name which selects every workspace of a
+// Terraform project.
+const allWorkspaces = "*"
+
+// defaultBinaries are the binaries to run for Terraform project directories if
+// none is configured, in order of preference.
+var defaultBinaries = []string{"terraform", "tofu"}
+
+// Terraform holds the settings for running Terraform (or OpenTofu) to read the
+// state of Terraform project directories. The zero value runs `terraform`, or
+// `tofu` if `terraform` isn't installed.
+type Terraform struct {
+
+	// Name or path of the binary, e.g. `tofu` or a wrapper script.
+	Binary string `yaml:"binary"`
+
+	// Additional arguments, which are passed before the subcommand, e.g.
+	// `-chdir=infra`.
+	Args []string `yaml:"args"`
+
+	// Additional environment variables.
+	Env map[string]string `yaml:"env"`
+}
+
+// binary returns the binary to run.
+func (tf *Terraform) binary() string {
+	if tf.Binary != "" {
+		return tf.Binary
+	}
+
+	for _, bin := range defaultBinaries {
+		if _, err := exec.LookPath(bin); err == nil {
+			return bin
+		}
+	}
+
+	return defaultBinaries[0]
+}
+
+// command returns a command running the binary with the given arguments in the
+// given project directory. If workspace is set, the command runs in that
+// workspace instead of the currently selected one.
+func (tf *Terraform) command(dir string, workspace string, args ...string) *exec.Cmd {
+	cmd := exec.Command(tf.binary(), append(append([]string{}, tf.Args...), args...)...)
+	cmd.Dir = dir
+
+	if workspace != "" || len(tf.Env) > 0 {
+		keys := []string{}
+		for k := range tf.Env {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		cmd.Env = os.Environ()
+		for _, k := range keys {
+			cmd.Env = append(cmd.Env, k+"="+tf.Env[k])
+		}
+		if workspace != "" {
+			cmd.Env = append(cmd.Env, "TF_WORKSPACE="+workspace)
+		}
+	}
+
+	return cmd
+}
+
+// state returns the state of the Terraform project in the given directory,
+// using `terraform show -json` and falling back to `terraform state pull` for
+// pre-0.12 versions.
+func (tf *Terraform) state(dir string, workspace string) (*bytes.Buffer, error) {
+	var out bytes.Buffer
+
+	cmd := tf.command(dir, workspace, "show", "-json")
+	cmd.Stdout = &out
+	err := cmd.Run()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error running `%s show -json` in directory %s, %s, falling back to trying Terraform pre-0.12 command\n", tf.binary(), dir, err)
+
+		cmd = tf.command(dir, workspace, "state", "pull")
+		out.Reset()
+		cmd.Stdout = &out
+		err = cmd.Run()
+
+		if err != nil {
+			return nil, fmt.Errorf("Error running `%s state pull` in directory %s, %s", tf.binary(), dir, err)
+		}
+	}
+
+	return &out, nil
+}
+
+// workspaces returns the names of all workspaces of the Terraform project in
+// the given directory.
+func (tf *Terraform) workspaces(dir string) ([]string, error) {
+	var out bytes.Buffer
+
+	cmd := tf.command(dir, "", "workspace", "list")
+	cmd.Stdout = &out
+	err := cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("Error running `%s workspace list` in directory %s, %s", tf.binary(), dir, err)
+	}
+
+	return parseWorkspaceList(&out), nil
+}
+
+// parseWorkspaceList parses the output of `terraform workspace list`, which
+// lists one workspace per line and marks the selected one with an asterisk.
+func parseWorkspaceList(r io.Reader) []string {
+	var workspaces []string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		name := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(scanner.Text()), "*"))
+		if name != "" {
+			workspaces = append(workspaces, name)
+		}
+	}
+
+	return workspaces
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/adammck/venv"
+	"github.com/blang/vfs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseWorkspaceList(t *testing.T) {
+	out := "  default\n* staging\n  prod\n\n"
+	assert.Equal(t, []string{"default", "staging", "prod"}, parseWorkspaceList(strings.NewReader(out)))
+
+	assert.Nil(t, parseWorkspaceList(strings.NewReader("")))
+}
+
+// fakeBinary puts a shell script of the given name on the PATH. It returns the
+// directory of the script and a function which restores the PATH.
+func fakeBinary(t *testing.T, name string, script string) (string, func()) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake binaries are shell scripts")
+	}
+
+	bin, err := ioutil.TempDir("", "terraform-inventory-bin")
+	assert.NoError(t, err)
+
+	err = ioutil.WriteFile(filepath.Join(bin, name), []byte("#!/bin/sh\n"+script), 0755)
+	assert.NoError(t, err)
+
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", bin+string(os.PathListSeparator)+path)
+	return bin, func() {
+		os.Setenv("PATH", path)
+		os.RemoveAll(bin)
+	}
+}
+
+// fakeTerraform puts a `terraform` script on the PATH, which lists the given
+// workspaces and pulls the state of the workspace in TF_WORKSPACE from the file
+// of the same name in the directory it runs in. It returns a function which
+// restores the PATH.
+func fakeTerraform(t *testing.T, workspaces string) func() {
+	_, restore := fakeBinary(t, "terraform", `
+case "$1" in
+workspace) printf '`+workspaces+`' ;;
+show) exit 1 ;;
+state) cat "${TF_WORKSPACE:-default}" ;;
+esac
+`)
+	return restore
+}
+
+func TestReadStatesAllWorkspaces(t *testing.T) {
+	defer fakeTerraform(t, `* default\n  staging\n  prod\n`)()
+
+	dir, err := ioutil.TempDir("", "terraform-inventory-project")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// The default workspace is empty, and therefore skipped
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "staging"), []byte(exampleStateFileTerraformV4), 0600))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "prod"), []byte(exampleStateFileAzure), 0600))
+
+	states, err := readStates(vfs.OS(), venv.OS(), &Terraform{}, &Encryption{}, dir, allWorkspaces)
+	assert.NoError(t, err)
+	assert.Len(t, states, 2)
+	assert.Equal(t, "staging", states[0].Name)
+	assert.Equal(t, dir+" (workspace staging)", states[0].Source)
+	assert.Equal(t, "prod", states[1].Name)
+
+	var stdout, stderr bytes.Buffer
+	exitCode := cmdList(&stdout, &stderr, states, &Config{})
+	assert.Equal(t, 0, exitCode)
+
+	var act map[string]interface{}
+	err = json.Unmarshal(stdout.Bytes(), &act)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"10.0.0.2", "10.0.0.4", "10.0.1.2", "192.168.0.5", "35.159.25.34"}, act["staging"])
+	assert.Equal(t, []interface{}{"10.1.0.6", "20.0.0.4", "20.0.0.5"}, act["prod"])
+
+	// A single workspace is read unnamed
+	states, err = readStates(vfs.OS(), venv.OS(), &Terraform{}, &Encryption{}, dir, "prod")
+	assert.NoError(t, err)
+	assert.Len(t, states, 1)
+	assert.Equal(t, "", states[0].Name)
+	assert.Len(t, states[0].resources(), 3)
+
+	// Without any state, it's an error
+	_, err = readStates(vfs.OS(), venv.OS(), &Terraform{}, &Encryption{}, dir, "default")
+	assert.Error(t, err)
+}
+
+func TestTerraformBinary(t *testing.T) {
+	bin, restore := fakeBinary(t, "tofu", "exit 1\n")
+	defer restore()
+
+	// Only the fake binary is on the PATH
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", bin)
+	defer os.Setenv("PATH", path)
+
+	assert.Equal(t, "tofu", (&Terraform{}).binary())
+	assert.Equal(t, "tf-wrapper", (&Terraform{Binary: "tf-wrapper"}).binary())
+
+	os.Setenv("PATH", "")
+	assert.Equal(t, "terraform", (&Terraform{}).binary())
+}
+
+func TestTerraformArgsAndEnv(t *testing.T) {
+	// Expects the state file in -chdir and the workspace in STATE_WORKSPACE
+	_, restore := fakeBinary(t, "tofu-wrapper", `
+[ "$1" = "-chdir=infra" ] || exit 2
+[ "$2" = "show" ] && [ "$3" = "-json" ] || exit 3
+cat "infra/$STATE_WORKSPACE.json"
+`)
+	defer restore()
+
+	dir, err := ioutil.TempDir("", "terraform-inventory-project")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "infra"), 0700))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "infra", "prod.json"), []byte(exampleStateFileOpenTofu), 0600))
+
+	tf := &Terraform{
+		Binary: "tofu-wrapper",
+		Args:   []string{"-chdir=infra"},
+		Env:    map[string]string{"STATE_WORKSPACE": "prod"},
+	}
+	states, err := readStates(vfs.OS(), venv.OS(), tf, &Encryption{}, dir, "")
+	assert.NoError(t, err)
+	assert.Len(t, states, 1)
+	assert.Len(t, states[0].resources(), 1)
+}